@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
 	"net/http"
+	"strconv"
 
 	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
 	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
@@ -21,12 +22,42 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	defer trace.TraceHttpResponseWriter(w).End()
 
 	if dal == nil {
-		connStr, err := Core.Configuration.Get("internal-authentication-db")
-		if err != nil {
-			Core.Logger.Log(logger.FATAL, "failed to get database connection string: "+err.Error())
+		opts := make([]authentication.DALOption, 0)
+		passwordPolicy := authentication.DefaultPasswordPolicy
+		if policy, err := Core.Configuration.Get("authentication-password-policy"); err == nil && policy != "" {
+			if err := json.Unmarshal([]byte(policy), &passwordPolicy); err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse password policy: "+err.Error())
+			}
+		}
+		opts = append(opts, authentication.WithPasswordPolicy(passwordPolicy))
+		if depth, err := Core.Configuration.Get("authentication-password-history-depth"); err == nil && depth != "" {
+			passwordHistoryDepth, err := strconv.Atoi(depth)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse password history depth: "+err.Error())
+			}
+			opts = append(opts, authentication.WithPasswordHistory(passwordHistoryDepth))
+		}
+
+		// A password reset lifts a lockout, which only happens with the lockout policy applied.
+		lockoutPolicy := authentication.DefaultLockoutPolicy
+		if policy, err := Core.Configuration.Get("authentication-lockout-policy"); err == nil && policy != "" {
+			lockoutPolicy, err = authentication.ParseLockoutPolicy(policy)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse lockout policy: "+err.Error())
+			}
 		}
+		opts = append(opts, authentication.WithLockoutPolicy(lockoutPolicy))
 
-		dal, err = authentication.NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+		if pepperConfig, err := Core.Configuration.Get("authentication-pepper"); err == nil && pepperConfig != "" {
+			pepper, err := authentication.ParsePepper(pepperConfig)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to load password pepper: "+err.Error())
+			}
+			opts = append(opts, authentication.WithPepper(pepper))
+		}
+
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
 		if err != nil {
 			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
 		}
@@ -48,10 +79,15 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Password policy violations are returned as JSON so clients can show each of them.
+	status := http.StatusOK
 	if !resp.Valid {
 		Core.Logger.Log(logger.WARN, "LoginPassword operation was not valid for caller: "+caller+", error: "+resp.Error)
-		http.Error(w, resp.Error, http.StatusBadRequest)
-		return
+		if len(resp.PasswordViolations) == 0 {
+			http.Error(w, resp.Error, http.StatusBadRequest)
+			return
+		}
+		status = http.StatusBadRequest
 	}
 
 	respBytes, err := json.Marshal(resp)
@@ -63,7 +99,7 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	if _, err := w.Write(respBytes); err != nil {
 		Core.Logger.Log(logger.ERROR, "failed to write response for caller: "+caller+", error: "+err.Error())
 		return
@@ -0,0 +1,103 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
+	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
+)
+
+var (
+	Core, _ = core.NewCore()
+	dal     *authentication.DALPostgres
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	trace := Core.Tracing.TraceHttpRequest(r).Start()
+	defer trace.TraceHttpResponseWriter(w).End()
+
+	if dal == nil {
+		opts := make([]authentication.DALOption, 0)
+		keysConfig, err := Core.Configuration.Get("authentication-totp-encryption-key")
+		if err != nil || keysConfig == "" {
+			Core.Logger.Log(logger.FATAL, "TOTP needs authentication-totp-encryption-key")
+		}
+		keys, err := authentication.ParseEncryptionKeys(keysConfig, authentication.DefaultTOTPEncryptionKeyName)
+		if err != nil {
+			Core.Logger.Log(logger.FATAL, "failed to load TOTP encryption key: "+err.Error())
+		}
+		totpPolicy := authentication.DefaultTOTPPolicy
+		if policy, err := Core.Configuration.Get("authentication-totp-policy"); err == nil && policy != "" {
+			totpPolicy, err = authentication.ParseTOTPPolicy(policy)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse TOTP policy: "+err.Error())
+			}
+		}
+		opts = append(opts, authentication.WithTOTP(totpPolicy, keys))
+
+		lockoutPolicy := authentication.DefaultLockoutPolicy
+		if policy, err := Core.Configuration.Get("authentication-lockout-policy"); err == nil && policy != "" {
+			lockoutPolicy, err = authentication.ParseLockoutPolicy(policy)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse lockout policy: "+err.Error())
+			}
+		}
+		opts = append(opts, authentication.WithLockoutPolicy(lockoutPolicy))
+
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
+		if err != nil {
+			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
+		}
+	}
+
+	caller := r.Header.Get("Caller")
+
+	var req authentication.ConfirmTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to decode request body for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := dal.ConfirmTOTP(context.Background(), &req)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to confirm TOTP for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A locked account is returned as JSON with Retry-After so clients can tell when to try again.
+	status := http.StatusOK
+	if !resp.Valid {
+		Core.Logger.Log(logger.WARN, "ConfirmTOTP operation was not valid for caller: "+caller+", error: "+resp.Error)
+		if resp.ErrorCode != authentication.ErrorCodeAccountLocked {
+			http.Error(w, resp.Error, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(max(resp.LockedUntil-time.Now().Unix(), 1), 10))
+		status = http.StatusTooManyRequests
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to marshal response for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
+	w.WriteHeader(status)
+	if _, err := w.Write(respBytes); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to write response for caller: "+caller+", error: "+err.Error())
+		return
+	}
+
+	Core.Logger.Log(logger.DEBUG, "Successfully ConfirmTOTP for entity: "+req.Entity.String()+" for caller: "+caller)
+}
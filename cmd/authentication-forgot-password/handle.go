@@ -21,12 +21,26 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	defer trace.TraceHttpResponseWriter(w).End()
 
 	if dal == nil {
-		connStr, err := Core.Configuration.Get("internal-authentication-db")
-		if err != nil {
-			Core.Logger.Log(logger.FATAL, "failed to get database connection string: "+err.Error())
+		opts := make([]authentication.DALOption, 0)
+		if protection, err := Core.Configuration.Get("authentication-enumeration-protection"); err == nil && protection == "true" {
+			endpoint, err := Core.Configuration.Get("authentication-notification-url")
+			if err != nil || endpoint == "" {
+				Core.Logger.Log(logger.FATAL, "enumeration protection needs authentication-notification-url")
+			}
+			// Notifications are sent after the response, so failed deliveries are only logged.
+			webhook := authentication.NewWebhookNotifier(endpoint, nil)
+			notifier := authentication.NotifierFunc(func(ctx context.Context, notification authentication.Notification) error {
+				err := webhook.Notify(ctx, notification)
+				if err != nil {
+					Core.Logger.Log(logger.ERROR, "failed to send "+notification.Type+" notification: "+err.Error())
+				}
+				return err
+			})
+			opts = append(opts, authentication.WithEnumerationProtection(notifier))
 		}
 
-		dal, err = authentication.NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
 		if err != nil {
 			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
 		}
@@ -21,12 +21,8 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	defer trace.TraceHttpResponseWriter(w).End()
 
 	if dal == nil {
-		connStr, err := Core.Configuration.Get("internal-authentication-db")
-		if err != nil {
-			Core.Logger.Log(logger.FATAL, "failed to get database connection string: "+err.Error())
-		}
-
-		dal, err = authentication.NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0))
 		if err != nil {
 			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
 		}
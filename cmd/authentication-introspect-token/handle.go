@@ -0,0 +1,88 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+	"net/http"
+	"strings"
+
+	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
+	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
+)
+
+var (
+	Core, _ = core.NewCore()
+	dal     *authentication.DALPostgres
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	trace := Core.Tracing.TraceHttpRequest(r).Start()
+	defer trace.TraceHttpResponseWriter(w).End()
+
+	if dal == nil {
+		opts := make([]authentication.DALOption, 0)
+		if format, err := Core.Configuration.Get("authentication-token-format"); err == nil && format != "" {
+			if !authentication.TokenFormat(format).IsValid() {
+				Core.Logger.Log(logger.FATAL, "unsupported token format: "+format)
+			}
+			opts = append(opts, authentication.WithTokenFormat(authentication.TokenFormat(format)))
+		}
+
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
+		if err != nil {
+			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
+		}
+	}
+
+	caller := r.Header.Get("Caller")
+
+	// RFC 7662 callers send a form, internal callers send JSON like every other function.
+	var req authentication.IntrospectTokenRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			Core.Logger.Log(logger.ERROR, "failed to parse request form for caller: "+caller+", error: "+err.Error())
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Token = r.PostForm.Get("token")
+		req.TokenTypeHint = r.PostForm.Get("token_type_hint")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to decode request body for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := dal.IntrospectToken(context.Background(), &req)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to introspect token for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !resp.Valid {
+		Core.Logger.Log(logger.WARN, "IntrospectToken operation was not valid for caller: "+caller+", error: "+resp.Error)
+		http.Error(w, resp.Error, http.StatusBadRequest)
+		return
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to marshal response for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(respBytes); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to write response for caller: "+caller+", error: "+err.Error())
+		return
+	}
+
+	Core.Logger.Log(logger.DEBUG, "Successfully IntrospectToken for active: "+fmt.Sprintf("%t", resp.Active)+" for caller: "+caller)
+}
@@ -0,0 +1,79 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+	"net/http"
+
+	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
+	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
+)
+
+var (
+	Core, _ = core.NewCore()
+	dal     *authentication.DALPostgres
+)
+
+const jwksPath = "/.well-known/jwks.json"
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	trace := Core.Tracing.TraceHttpRequest(r).Start()
+	defer trace.TraceHttpResponseWriter(w).End()
+
+	if dal == nil {
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0))
+		if err != nil {
+			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
+		}
+	}
+
+	caller := r.Header.Get("Caller")
+
+	if r.URL.Path != jwksPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := dal.GetJWKS(context.Background(), &authentication.GetJWKSRequest{})
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to get JWKS for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !resp.Valid {
+		Core.Logger.Log(logger.WARN, "GetJWKS operation was not valid for caller: "+caller+", error: "+resp.Error)
+		http.Error(w, resp.Error, http.StatusInternalServerError)
+		return
+	}
+
+	respBytes, err := json.Marshal(resp.JWKS)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to marshal response for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", resp.CacheMaxAge))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(respBytes); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to write response for caller: "+caller+", error: "+err.Error())
+		return
+	}
+
+	Core.Logger.Log(logger.DEBUG, "Successfully GetJWKS for caller: "+caller)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
 	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
@@ -21,12 +23,64 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	defer trace.TraceHttpResponseWriter(w).End()
 
 	if dal == nil {
-		connStr, err := Core.Configuration.Get("internal-authentication-db")
-		if err != nil {
-			Core.Logger.Log(logger.FATAL, "failed to get database connection string: "+err.Error())
+		opts := make([]authentication.DALOption, 0)
+		if format, err := Core.Configuration.Get("authentication-token-format"); err == nil && format != "" {
+			if !authentication.TokenFormat(format).IsValid() {
+				Core.Logger.Log(logger.FATAL, "unsupported token format: "+format)
+			}
+			opts = append(opts, authentication.WithTokenFormat(authentication.TokenFormat(format)))
+		}
+		if rotation, err := Core.Configuration.Get("authentication-refresh-token-rotation"); err == nil && rotation == "true" {
+			opts = append(opts, authentication.WithRefreshTokenRotation())
+		}
+		if maxSessions, err := Core.Configuration.Get("authentication-max-active-sessions"); err == nil && maxSessions != "" {
+			maxActiveSessions, err := strconv.Atoi(maxSessions)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse max active sessions: "+err.Error())
+			}
+			policy, _ := Core.Configuration.Get("authentication-session-limit-policy")
+			if !authentication.SessionLimitPolicy(policy).IsValid() {
+				Core.Logger.Log(logger.FATAL, "unsupported session limit policy: "+policy)
+			}
+			opts = append(opts, authentication.WithSessionLimit(maxActiveSessions, authentication.SessionLimitPolicy(policy)))
 		}
 
-		dal, err = authentication.NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+		lockoutPolicy := authentication.DefaultLockoutPolicy
+		if policy, err := Core.Configuration.Get("authentication-lockout-policy"); err == nil && policy != "" {
+			lockoutPolicy, err = authentication.ParseLockoutPolicy(policy)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse lockout policy: "+err.Error())
+			}
+		}
+		opts = append(opts, authentication.WithLockoutPolicy(lockoutPolicy))
+
+		if protection, err := Core.Configuration.Get("authentication-enumeration-protection"); err == nil && protection == "true" {
+			endpoint, err := Core.Configuration.Get("authentication-notification-url")
+			if err != nil || endpoint == "" {
+				Core.Logger.Log(logger.FATAL, "enumeration protection needs authentication-notification-url")
+			}
+			// Notifications are sent after the response, so failed deliveries are only logged.
+			webhook := authentication.NewWebhookNotifier(endpoint, nil)
+			notifier := authentication.NotifierFunc(func(ctx context.Context, notification authentication.Notification) error {
+				err := webhook.Notify(ctx, notification)
+				if err != nil {
+					Core.Logger.Log(logger.ERROR, "failed to send "+notification.Type+" notification: "+err.Error())
+				}
+				return err
+			})
+			opts = append(opts, authentication.WithEnumerationProtection(notifier))
+		}
+
+		if pepperConfig, err := Core.Configuration.Get("authentication-pepper"); err == nil && pepperConfig != "" {
+			pepper, err := authentication.ParsePepper(pepperConfig)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to load password pepper: "+err.Error())
+			}
+			opts = append(opts, authentication.WithPepper(pepper))
+		}
+
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
 		if err != nil {
 			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
 		}
@@ -48,10 +102,16 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A locked account is returned as JSON with Retry-After so clients can tell when to try again.
+	status := http.StatusOK
 	if !resp.Valid {
 		Core.Logger.Log(logger.WARN, "LoginPassword operation was not valid for caller: "+caller+", error: "+resp.Error)
-		http.Error(w, resp.Error, http.StatusBadRequest)
-		return
+		if resp.ErrorCode != authentication.ErrorCodeAccountLocked {
+			http.Error(w, resp.Error, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(max(resp.LockedUntil-time.Now().Unix(), 1), 10))
+		status = http.StatusTooManyRequests
 	}
 
 	respBytes, err := json.Marshal(resp)
@@ -63,7 +123,7 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	if _, err := w.Write(respBytes); err != nil {
 		Core.Logger.Log(logger.ERROR, "failed to write response for caller: "+caller+", error: "+err.Error())
 		return
@@ -21,12 +21,16 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	defer trace.TraceHttpResponseWriter(w).End()
 
 	if dal == nil {
-		connStr, err := Core.Configuration.Get("internal-authentication-db")
-		if err != nil {
-			Core.Logger.Log(logger.FATAL, "failed to get database connection string: "+err.Error())
+		opts := make([]authentication.DALOption, 0)
+		if format, err := Core.Configuration.Get("authentication-token-format"); err == nil && format != "" {
+			if !authentication.TokenFormat(format).IsValid() {
+				Core.Logger.Log(logger.FATAL, "unsupported token format: "+format)
+			}
+			opts = append(opts, authentication.WithTokenFormat(authentication.TokenFormat(format)))
 		}
 
-		dal, err = authentication.NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
 		if err != nil {
 			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
 		}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
 	"net/http"
+	"strconv"
 
 	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
 	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
@@ -21,12 +22,37 @@ func Handle(w http.ResponseWriter, r *http.Request) {
 	defer trace.TraceHttpResponseWriter(w).End()
 
 	if dal == nil {
-		connStr, err := Core.Configuration.Get("internal-authentication-db")
-		if err != nil {
-			Core.Logger.Log(logger.FATAL, "failed to get database connection string: "+err.Error())
+		opts := make([]authentication.DALOption, 0)
+		if format, err := Core.Configuration.Get("authentication-token-format"); err == nil && format != "" {
+			if !authentication.TokenFormat(format).IsValid() {
+				Core.Logger.Log(logger.FATAL, "unsupported token format: "+format)
+			}
+			opts = append(opts, authentication.WithTokenFormat(authentication.TokenFormat(format)))
+		}
+		if rotation, err := Core.Configuration.Get("authentication-refresh-token-rotation"); err == nil && rotation == "true" {
+			opts = append(opts, authentication.WithRefreshTokenRotation())
+		}
+		if maxSessions, err := Core.Configuration.Get("authentication-max-active-sessions"); err == nil && maxSessions != "" {
+			maxActiveSessions, err := strconv.Atoi(maxSessions)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse max active sessions: "+err.Error())
+			}
+			policy, _ := Core.Configuration.Get("authentication-session-limit-policy")
+			if !authentication.SessionLimitPolicy(policy).IsValid() {
+				Core.Logger.Log(logger.FATAL, "unsupported session limit policy: "+policy)
+			}
+			opts = append(opts, authentication.WithSessionLimit(maxActiveSessions, authentication.SessionLimitPolicy(policy)))
+		}
+		if deviceBinding, err := Core.Configuration.Get("authentication-device-binding"); err == nil && deviceBinding != "" {
+			var policy authentication.DeviceBindingPolicy
+			if err := json.Unmarshal([]byte(deviceBinding), &policy); err != nil || !policy.Mode.IsValid() {
+				Core.Logger.Log(logger.FATAL, "failed to parse device binding policy: "+deviceBinding)
+			}
+			opts = append(opts, authentication.WithDeviceBinding(policy))
 		}
 
-		dal, err = authentication.NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
 		if err != nil {
 			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
 		}
@@ -0,0 +1,29 @@
+module function
+
+go 1.24.4
+
+require (
+	github.com/CoreKitMDK/corekit-service-authentication/v2 v2.0.0-20250717162405-74da8280f25e
+	github.com/CoreKitMDK/corekit-service-authorization/v2 v2.0.4
+	github.com/CoreKitMDK/corekit-service-core/v2 v2.0.0-20250629085202-db1ab1f3d980
+	github.com/CoreKitMDK/corekit-service-logger/v2 v2.0.6
+	github.com/google/uuid v1.6.0
+)
+
+require (
+	github.com/CoreKitMDK/corekit-service-configuration/v2 v2.0.1 // indirect
+	github.com/CoreKitMDK/corekit-service-events/v2 v2.0.0-20250629083642-6bb97350fb4c // indirect
+	github.com/CoreKitMDK/corekit-service-metrics/v2 v2.0.3 // indirect
+	github.com/CoreKitMDK/corekit-service-tracing/v2 v2.0.1 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.3 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/pgx/v5 v5.7.5 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/nats-io/nats.go v1.43.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	golang.org/x/crypto v0.40.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
+)
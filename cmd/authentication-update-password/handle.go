@@ -0,0 +1,114 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CoreKitMDK/corekit-service-core/v2/pkg/core"
+	"github.com/CoreKitMDK/corekit-service-logger/v2/pkg/logger"
+)
+
+var (
+	Core, _ = core.NewCore()
+	dal     *authentication.DALPostgres
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	trace := Core.Tracing.TraceHttpRequest(r).Start()
+	defer trace.TraceHttpResponseWriter(w).End()
+
+	if dal == nil {
+		opts := make([]authentication.DALOption, 0)
+		passwordPolicy := authentication.DefaultPasswordPolicy
+		if policy, err := Core.Configuration.Get("authentication-password-policy"); err == nil && policy != "" {
+			if err := json.Unmarshal([]byte(policy), &passwordPolicy); err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse password policy: "+err.Error())
+			}
+		}
+		opts = append(opts, authentication.WithPasswordPolicy(passwordPolicy))
+		if depth, err := Core.Configuration.Get("authentication-password-history-depth"); err == nil && depth != "" {
+			passwordHistoryDepth, err := strconv.Atoi(depth)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse password history depth: "+err.Error())
+			}
+			opts = append(opts, authentication.WithPasswordHistory(passwordHistoryDepth))
+		}
+
+		lockoutPolicy := authentication.DefaultLockoutPolicy
+		if policy, err := Core.Configuration.Get("authentication-lockout-policy"); err == nil && policy != "" {
+			lockoutPolicy, err = authentication.ParseLockoutPolicy(policy)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to parse lockout policy: "+err.Error())
+			}
+		}
+		opts = append(opts, authentication.WithLockoutPolicy(lockoutPolicy))
+
+		if pepperConfig, err := Core.Configuration.Get("authentication-pepper"); err == nil && pepperConfig != "" {
+			pepper, err := authentication.ParsePepper(pepperConfig)
+			if err != nil {
+				Core.Logger.Log(logger.FATAL, "failed to load password pepper: "+err.Error())
+			}
+			opts = append(opts, authentication.WithPepper(pepper))
+		}
+
+		var err error
+		dal, err = authentication.NewAuthenticationDALPostgresFromConfiguration(Core.Configuration.Get, "https://test.com", make([]string, 0), opts...)
+		if err != nil {
+			Core.Logger.Log(logger.FATAL, "failed to initialize Authentication DAL: "+err.Error())
+		}
+	}
+
+	caller := r.Header.Get("Caller")
+
+	var req authentication.UpdatePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to decode request body for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := dal.UpdatePassword(context.Background(), &req)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to update password for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Password policy violations and locks are returned as JSON so clients can show them.
+	status := http.StatusOK
+	if !resp.Valid {
+		Core.Logger.Log(logger.WARN, "LoginPassword operation was not valid for caller: "+caller+", error: "+resp.Error)
+		switch {
+		case resp.ErrorCode == authentication.ErrorCodeAccountLocked:
+			w.Header().Set("Retry-After", strconv.FormatInt(max(resp.LockedUntil-time.Now().Unix(), 1), 10))
+			status = http.StatusTooManyRequests
+		case len(resp.PasswordViolations) > 0:
+			status = http.StatusBadRequest
+		default:
+			http.Error(w, resp.Error, http.StatusBadRequest)
+			return
+		}
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to marshal response for caller: "+caller+", error: "+err.Error())
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
+	w.WriteHeader(status)
+	if _, err := w.Write(respBytes); err != nil {
+		Core.Logger.Log(logger.ERROR, "failed to write response for caller: "+caller+", error: "+err.Error())
+		return
+	}
+
+	Core.Logger.Log(logger.DEBUG, "Successfully UpdatePassword for entity: "+req.Entity.String()+" for caller: "+caller)
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    kid TEXT UNIQUE NOT NULL,
+    algorithm VARCHAR(16) NOT NULL,
+
+    private_key TEXT NOT NULL, -- PKCS#8 PEM
+    public_key TEXT NOT NULL, -- PKIX PEM
+
+    state VARCHAR(32) NOT NULL DEFAULT 'active', -- active | verifying | retired
+
+    created_at BIGINT NOT NULL DEFAULT current_epoch(),
+    rotate_at BIGINT DEFAULT NULL, -- when the active key is due for scheduled rotation
+    verify_until BIGINT DEFAULT NULL, -- when a verifying key is retired
+    retired_at BIGINT DEFAULT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS signing_keys_single_active_idx ON signing_keys (state) WHERE state = 'active';
@@ -0,0 +1,11 @@
+ALTER TABLE entity_refresh_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE entity_refresh_tokens ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES entity_refresh_tokens(id);
+ALTER TABLE entity_refresh_tokens ADD COLUMN IF NOT EXISTS rotated_at BIGINT DEFAULT NULL;
+
+-- Every existing refresh token starts its own family.
+UPDATE entity_refresh_tokens SET family_id = id WHERE family_id IS NULL;
+
+ALTER TABLE entity_refresh_tokens ALTER COLUMN family_id SET DEFAULT gen_random_uuid();
+ALTER TABLE entity_refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS entity_refresh_tokens_family_id_idx ON entity_refresh_tokens (family_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS entity_security_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    entity_id UUID NOT NULL REFERENCES entities(id),
+
+    event_type VARCHAR(255) NOT NULL,
+    details TEXT DEFAULT NULL,
+
+    ip_address TEXT DEFAULT NULL,
+    user_agent TEXT DEFAULT NULL,
+    device_fingerprint TEXT DEFAULT NULL,
+
+    created_at BIGINT NOT NULL DEFAULT current_epoch()
+);
+
+CREATE INDEX IF NOT EXISTS entity_security_events_entity_id_idx ON entity_security_events (entity_id);
@@ -0,0 +1,13 @@
+-- Bearer tokens are no longer stored, only their SHA-256 digest (hex), looked up together with token_random_id (jti).
+
+ALTER TABLE entity_refresh_tokens ADD COLUMN IF NOT EXISTS token_hash TEXT;
+UPDATE entity_refresh_tokens SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex') WHERE token_hash IS NULL;
+ALTER TABLE entity_refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE entity_refresh_tokens DROP COLUMN IF EXISTS token;
+CREATE INDEX IF NOT EXISTS entity_refresh_tokens_token_random_id_idx ON entity_refresh_tokens (token_random_id);
+
+ALTER TABLE entity_tokens ADD COLUMN IF NOT EXISTS token_hash TEXT;
+UPDATE entity_tokens SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex') WHERE token_hash IS NULL;
+ALTER TABLE entity_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE entity_tokens DROP COLUMN IF EXISTS token;
+CREATE INDEX IF NOT EXISTS entity_tokens_token_random_id_idx ON entity_tokens (token_random_id);
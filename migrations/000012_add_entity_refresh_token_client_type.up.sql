@@ -0,0 +1,2 @@
+-- Remembers which client a session was opened from, so refreshes keep that client's token lifetimes.
+ALTER TABLE entity_refresh_tokens ADD COLUMN IF NOT EXISTS client_type TEXT NOT NULL DEFAULT '';
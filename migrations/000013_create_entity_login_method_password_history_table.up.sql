@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS entity_login_method_password_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    method_id UUID NOT NULL REFERENCES entity_login_method_password(id),
+
+    password_hash VARCHAR(255) NOT NULL,
+
+    created_at BIGINT NOT NULL DEFAULT current_epoch()
+);
+
+CREATE INDEX IF NOT EXISTS entity_login_method_password_history_method_id_idx ON entity_login_method_password_history (method_id, created_at DESC);
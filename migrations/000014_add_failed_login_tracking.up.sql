@@ -0,0 +1,8 @@
+-- Counts failed logins per password login method and per entity, and locks either until locked_until.
+ALTER TABLE entity_login_method_password ADD COLUMN IF NOT EXISTS failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE entity_login_method_password ADD COLUMN IF NOT EXISTS last_failed_at BIGINT DEFAULT NULL;
+ALTER TABLE entity_login_method_password ADD COLUMN IF NOT EXISTS locked_until BIGINT DEFAULT NULL;
+
+ALTER TABLE entities ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE entities ADD COLUMN IF NOT EXISTS last_failed_login_at BIGINT DEFAULT NULL;
+ALTER TABLE entities ADD COLUMN IF NOT EXISTS locked_until BIGINT DEFAULT NULL;
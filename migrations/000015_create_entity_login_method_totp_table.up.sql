@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS entity_login_method_totp (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    -- AES-GCM sealed, prefixed with the version of the encryption key.
+    secret_ciphertext TEXT NOT NULL,
+
+    confirmed_at BIGINT DEFAULT NULL,
+    -- Highest time step accepted so far. Codes for it or earlier steps are replays.
+    last_used_step BIGINT DEFAULT NULL,
+
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_at BIGINT DEFAULT NULL,
+    locked_until BIGINT DEFAULT NULL,
+
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at BIGINT NOT NULL DEFAULT current_epoch(),
+    deleted_at BIGINT
+);
@@ -0,0 +1,3 @@
+-- Private keys are stored sealed (v<version>$<base64>) and only while a key is active; verifying needs the public key alone.
+ALTER TABLE signing_keys ALTER COLUMN private_key DROP NOT NULL;
+UPDATE signing_keys SET private_key = NULL WHERE state <> 'active';
@@ -0,0 +1,2 @@
+-- The audience a session was opened for, so refreshes issue tokens for it. NULL means all of the service's audiences.
+ALTER TABLE entity_refresh_tokens ADD COLUMN IF NOT EXISTS audience TEXT DEFAULT NULL;
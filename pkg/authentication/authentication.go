@@ -2,8 +2,11 @@ package authentication
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"sync"
 	"time"
 )
 
@@ -22,29 +25,115 @@ type IDAL interface {
 	ChangePassword(ctx context.Context, req *ChangePasswordRequest) (*ChangePasswordResponse, error)
 	DeleteEntity(ctx context.Context, req *DeleteEntityRequest) (*DeleteEntityResponse, error)
 	GetEntityDetails(ctx context.Context, req *GetEntityDetailsRequest) (*GetEntityDetailsResponse, error)
+	GetJWKS(ctx context.Context, req *GetJWKSRequest) (*GetJWKSResponse, error)
+	RotateSigningKey(ctx context.Context, req *RotateSigningKeyRequest) (*RotateSigningKeyResponse, error)
+	IntrospectToken(ctx context.Context, req *IntrospectTokenRequest) (*IntrospectTokenResponse, error)
+	ListSessions(ctx context.Context, req *ListSessionsRequest) (*ListSessionsResponse, error)
+	RevokeSession(ctx context.Context, req *RevokeSessionRequest) (*RevokeSessionResponse, error)
+	UpdatePassword(ctx context.Context, req *UpdatePasswordRequest) (*UpdatePasswordResponse, error)
+	UnlockEntity(ctx context.Context, req *UnlockEntityRequest) (*UnlockEntityResponse, error)
+	EnrollTOTP(ctx context.Context, req *EnrollTOTPRequest) (*EnrollTOTPResponse, error)
+	ConfirmTOTP(ctx context.Context, req *ConfirmTOTPRequest) (*ConfirmTOTPResponse, error)
+	VerifyTOTP(ctx context.Context, req *VerifyTOTPRequest) (*VerifyTOTPResponse, error)
+	DisableTOTP(ctx context.Context, req *DisableTOTPRequest) (*DisableTOTPResponse, error)
 }
 
 type DALPostgres struct {
-	db              *pgx.Conn
-	tokenIssuer     string
-	tokenAudience   []string
-	tokenSigningKey string
+	db            *pgx.Conn
+	tokenIssuer   string
+	tokenAudience []string
+	signer        Signer
+	keyRing       *KeyRing
+
+	validator            *TokenValidator
+	validationPolicy     *TokenValidationPolicy
+	tokenFormat          TokenFormat
+	lifetimePolicy       TokenLifetimePolicy
+	claimsEnricher       ClaimsEnricher
+	rotateRefreshTokens  bool
+	maxActiveSessions    int
+	sessionLimitPolicy   SessionLimitPolicy
+	deviceBinding        DeviceBindingPolicy
+	passwordHasher       PasswordHasher
+	passwordPolicy       *PasswordPolicy
+	passwordHistoryDepth int
+	lockoutPolicy        *LockoutPolicy
+	notifier             Notifier
+	pepper               *Pepper
+	totpPolicy           TOTPPolicy
+	totpKeys             *EncryptionKeys
+	dummyHashOnce        sync.Once
+	dummyHash            string
+	notifying            sync.WaitGroup
 }
 
-func NewAuthenticationDALPostgres(connString string, tokenIssuer string, tokenAudience []string, tokenSigningKey string) (*DALPostgres, error) {
+// dbtx is satisfied by both *pgx.Conn and pgx.Tx.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func NewAuthenticationDALPostgres(connString string, tokenIssuer string, tokenAudience []string, signer Signer, opts ...DALOption) (*DALPostgres, error) {
 	conn, err := pgx.Connect(context.Background(), connString)
 	if err != nil {
 		return nil, err
 	}
-	return &DALPostgres{
-		db:              conn,
-		tokenIssuer:     tokenIssuer,
-		tokenAudience:   tokenAudience,
-		tokenSigningKey: tokenSigningKey,
-	}, nil
+
+	dal := &DALPostgres{
+		db:             conn,
+		tokenIssuer:    tokenIssuer,
+		tokenAudience:  tokenAudience,
+		signer:         signer,
+		tokenFormat:    TokenFormatJWT,
+		lifetimePolicy: DefaultTokenLifetimePolicy,
+		passwordHasher: DefaultArgon2idHasher,
+		totpPolicy:     DefaultTOTPPolicy,
+	}
+	for _, opt := range opts {
+		opt(dal)
+	}
+
+	policy := TokenValidationPolicy{Issuer: tokenIssuer, Audiences: tokenAudience, RequiredClaims: defaultRequiredClaims}
+	if dal.validationPolicy != nil {
+		policy = *dal.validationPolicy
+	}
+	dal.validator = NewTokenValidator(signer, policy)
+
+	return dal, nil
+}
+
+// NewAuthenticationDALPostgresWithKeyRing signs tokens with keys stored in the signing_keys table,
+// creating the first key if none is active and rotating them according to policy. Private keys are sealed
+// with encryptionKeys. The policy's VerificationPeriod must cover the longest token lifetime, see
+// KeyRotationPolicy.CoveringLifetimes.
+func NewAuthenticationDALPostgresWithKeyRing(connString string, tokenIssuer string, tokenAudience []string, policy KeyRotationPolicy, encryptionKeys EncryptionKeys, opts ...DALOption) (*DALPostgres, error) {
+	keyRing, err := NewKeyRing(context.Background(), connString, policy, encryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	dal, err := NewAuthenticationDALPostgres(connString, tokenIssuer, tokenAudience, keyRing, opts...)
+	if err != nil {
+		keyRing.Close()
+		return nil, err
+	}
+	dal.keyRing = keyRing
+
+	if longest := dal.lifetimePolicy.LongestTTL(); policy.VerificationPeriod < longest {
+		dal.Close()
+		return nil, fmt.Errorf("signing key verification period %s is shorter than the longest token lifetime %s", policy.VerificationPeriod, longest)
+	}
+	return dal, nil
 }
 
 func (dal *DALPostgres) Close() {
+	dal.notifying.Wait()
+
+	if dal.keyRing != nil {
+		dal.keyRing.Close()
+	}
+
 	err := dal.db.Close(context.Background())
 	if err != nil {
 		return
@@ -52,7 +141,15 @@ func (dal *DALPostgres) Close() {
 }
 
 func (dal *DALPostgres) LoginPassword(ctx context.Context, req *LoginPasswordRequest) (*LoginPasswordResponse, error) {
-	query1 := `SELECT e.id, elmp.password_hash FROM entities e 
+	if !req.ClientType.IsValid() {
+		return &LoginPasswordResponse{Valid: false, Error: "Unsupported client type"}, nil
+	}
+	audience, ok := dal.issuedAudience(req.Audience)
+	if !ok {
+		return &LoginPasswordResponse{Valid: false, Error: reasonUnsupportedAudience}, nil
+	}
+
+	query1 := `SELECT e.id, e.primary_email, elmp.id, elmp.password_hash FROM entities e 
     			JOIN entity_login_methods elm ON e.id = elm.entity_id
     			JOIN entity_login_method_password elmp  ON elm.method_id = elmp.id
     			WHERE elm.method_type = 'entity_login_method_password' AND elmp.identifier = $1 
@@ -66,21 +163,56 @@ func (dal *DALPostgres) LoginPassword(ctx context.Context, req *LoginPasswordReq
 
 	passwordHash := ""
 	entityIDString := ""
+	primaryEmail := ""
+	passwordMethodID := uuid.Nil
 	for rows.Next() {
-		err := rows.Scan(&entityIDString, &passwordHash)
+		err := rows.Scan(&entityIDString, &primaryEmail, &passwordMethodID, &passwordHash)
 		if err != nil {
 			return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 		}
 	}
 
+	if passwordMethodID == uuid.Nil {
+		if !dal.enumerationProtection() {
+			return &LoginPasswordResponse{Valid: false, Error: "Not found"}, nil
+		}
+		// Compare anyway so that an unknown identifier takes as long as a wrong password.
+		dal.passwordMatches(dal.dummyPasswordHash(), req.Password)
+		return &LoginPasswordResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: "Incorrect password"}, nil
+	}
+
 	entityID, err := uuid.Parse(entityIDString)
 	if err != nil {
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	isPasswordCorrect := IsHashSameAsUnhashedString(passwordHash, req.Password)
+	lockedUntil, err := dal.loginLockedUntil(ctx, dal.db, entityID, loginMethodPassword, passwordMethodID)
+	if err != nil {
+		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	if lockedUntil > 0 {
+		if dal.enumerationProtection() {
+			// Compare anyway and answer as for a wrong password, so that a lock does not tell the account exists.
+			dal.passwordMatches(passwordHash, req.Password)
+			return &LoginPasswordResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: "Incorrect password"}, nil
+		}
+		return &LoginPasswordResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+	}
+
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+
+	isPasswordCorrect := dal.passwordMatches(passwordHash, req.Password)
 	if !isPasswordCorrect {
-		return &LoginPasswordResponse{Valid: false, Error: "Incorrect password"}, nil
+		lockedUntil, err := dal.recordFailedLogin(ctx, entityID, loginMethodPassword, passwordMethodID, client)
+		if err != nil {
+			return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+		if lockedUntil > 0 && dal.enumerationProtection() {
+			dal.notify(ctx, Notification{Type: NotificationAccountLocked, Entity: entityID, PrimaryEmail: primaryEmail, LockedUntil: lockedUntil})
+		} else if lockedUntil > 0 {
+			return &LoginPasswordResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+		}
+		return &LoginPasswordResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: "Incorrect password"}, nil
 	}
 
 	tx, err := dal.db.Begin(ctx)
@@ -89,20 +221,47 @@ func (dal *DALPostgres) LoginPassword(ctx context.Context, req *LoginPasswordReq
 	}
 	defer tx.Rollback(ctx)
 
+	err = dal.resetFailedLogins(ctx, tx, entityID, loginMethodPassword, passwordMethodID)
+	if err != nil {
+		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	evictedSessions, rejected, err := dal.enforceSessionLimit(ctx, tx, entityID, uuid.Nil, client)
+	if err != nil {
+		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	if rejected {
+		return &LoginPasswordResponse{Valid: false, Error: reasonTooManySessions}, nil
+	}
+
+	if dal.passwordNeedsRehash(passwordHash) {
+		newPasswordHash, err := dal.hashPassword(req.Password)
+		if err != nil {
+			return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+
+		query2 := `UPDATE entity_login_method_password SET password_hash = $1 WHERE id = $2 AND password_hash = $3;`
+		_, err = tx.Exec(ctx, query2, newPasswordHash, passwordMethodID, passwordHash)
+		if err != nil {
+			return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
 	randomRefreshTokenId, err := GetRandomAlphanumericString(32)
 	if err != nil {
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	refreshTokenExpiresAt := time.Now().UTC().Add(time.Hour * 24 * 30)
-	refreshToken, err := GenerateJWT(dal.tokenIssuer, entityID.String(), dal.tokenAudience, refreshTokenExpiresAt, time.Now().UTC(), time.Now().UTC(), randomRefreshTokenId, dal.tokenSigningKey)
+	lifetime := dal.tokenLifetime(req.ClientType, audience)
+	refreshTokenExpiresAt := time.Now().UTC().Add(lifetime.RefreshTokenTTL)
+	refreshToken, err := dal.generateRefreshToken(entityID, randomRefreshTokenId, audience, refreshTokenExpiresAt)
 	if err != nil {
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
 	entityRefreshTokenIdString := ""
-	query2 := `INSERT INTO entity_refresh_tokens (entity_id, token, token_random_id, expires_at) VALUES ($1, $2, $3, $4)  RETURNING id;`
-	err = tx.QueryRow(ctx, query2, entityID, refreshToken, randomRefreshTokenId, refreshTokenExpiresAt.Unix()).Scan(&entityRefreshTokenIdString)
+	query3 := `INSERT INTO entity_refresh_tokens (entity_id, token_hash, token_random_id, client_type, audience, ip_address, user_agent, device_fingerprint, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)  RETURNING id;`
+	err = tx.QueryRow(ctx, query3, entityID, HashToken(refreshToken), randomRefreshTokenId, req.ClientType, storedAudience(req.Audience), client.IPAddress, client.UserAgent, client.DeviceFingerprint, refreshTokenExpiresAt.Unix()).Scan(&entityRefreshTokenIdString)
 	if err != nil {
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
@@ -112,14 +271,22 @@ func (dal *DALPostgres) LoginPassword(ctx context.Context, req *LoginPasswordReq
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	tokenExpiresAt := time.Now().UTC().Add(time.Minute * 15)
-	token, err := GenerateJWT(dal.tokenIssuer, entityID.String(), dal.tokenAudience, refreshTokenExpiresAt, time.Now().UTC(), time.Now().UTC(), randomTokenId, dal.tokenSigningKey)
+	entityRefreshTokenId, err := uuid.Parse(entityRefreshTokenIdString)
+	if err != nil {
+		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	tokenExpiresAt := time.Now().UTC().Add(lifetime.AccessTokenTTL)
+	token, err := dal.generateAccessToken(ctx, tx, entityID, entityRefreshTokenId, randomTokenId, audience, tokenExpiresAt)
 	if err != nil {
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	query3 := `INSERT INTO entity_tokens (entity_id, token, token_random_id, refresh_token_id, expires_at) VALUES ($1, $2, $3, $4,  $5);`
-	_, err = tx.Exec(ctx, query3, entityID, token, randomTokenId, entityRefreshTokenIdString, tokenExpiresAt.Unix())
+	query4 := `INSERT INTO entity_tokens (entity_id, token_hash, token_random_id, refresh_token_id, ip_address, user_agent, device_fingerprint, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	_, err = tx.Exec(ctx, query4, entityID, HashToken(token), randomTokenId, entityRefreshTokenId, client.IPAddress, client.UserAgent, client.DeviceFingerprint, tokenExpiresAt.Unix())
+	if err != nil {
+		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
 
 	if err = tx.Commit(ctx); err != nil {
 		return &LoginPasswordResponse{Valid: false, Error: err.Error()}, err
@@ -131,79 +298,51 @@ func (dal *DALPostgres) LoginPassword(ctx context.Context, req *LoginPasswordReq
 		TokenExpiresAt:        tokenExpiresAt.Unix(),
 		RefreshToken:          refreshToken,
 		RefreshTokenExpiresAt: refreshTokenExpiresAt.Unix(),
+		EvictedSessions:       evictedSessions,
 		Valid:                 true,
 		Error:                 "",
 	}, nil
 }
 
 func (dal *DALPostgres) LoginRefreshToken(ctx context.Context, req *LoginRefreshTokenRequest) (*LoginRefreshTokenResponse, error) {
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
 
-	parsedRefreshToken, err := VerifyJWT(req.RefreshToken, dal.tokenSigningKey)
-	if err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	err = ValidateJWT(parsedRefreshToken)
-	if err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	query1 := `SELECT id, token, token_random_id FROM entity_refresh_tokens WHERE entity_id = $1 AND token = $2 AND active = true AND expires_at > current_epoch();`
-	rows, err := dal.db.Query(ctx, query1, req.Entity, req.RefreshToken)
+	session, reason, err := dal.refreshSession(ctx, req.Entity, req.RefreshToken, client)
 	if err != nil {
 		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
 	}
-	defer rows.Close()
 
-	refreshTokenIdString := ""
-	refreTokenRandomId := ""
-	refreshTokenString := ""
-	for rows.Next() {
-		err := rows.Scan(&refreshTokenIdString, &refreshTokenString, &refreTokenRandomId)
-		if err != nil {
-			return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
-		}
+	if reason != "" {
+		return &LoginRefreshTokenResponse{Valid: false, Error: reason}, nil
 	}
 
-	randomTokenId, err := GetRandomAlphanumericString(32)
-	if err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	refreshTokenId, err := uuid.Parse(refreshTokenIdString)
-	if err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
+	return &LoginRefreshTokenResponse{
+		Entity:                req.Entity,
+		Token:                 session.Token,
+		TokenExpiresAt:        session.TokenExpiresAt.Unix(),
+		RefreshToken:          session.RefreshToken,
+		RefreshTokenExpiresAt: session.RefreshTokenExpiresAt.Unix(),
+		EvictedSessions:       session.EvictedSessions,
+		Warning:               session.Warning,
+		Valid:                 true,
+		Error:                 "",
+	}, nil
+}
 
-	tokenExpiresAt := time.Now().UTC().Add(time.Minute * 15)
-	token, err := GenerateJWT(dal.tokenIssuer, req.Entity.String(), dal.tokenAudience, tokenExpiresAt, time.Now().UTC(), time.Now().UTC(), randomTokenId, dal.tokenSigningKey)
-	if err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
+func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPasswordRequest) (*RegisterPasswordResponse, error) {
+	if !req.ClientType.IsValid() {
+		return &RegisterPasswordResponse{Valid: false, Error: "Unsupported client type"}, nil
 	}
-
-	tx, err := dal.db.Begin(ctx)
-	if err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
+	audience, ok := dal.issuedAudience(req.Audience)
+	if !ok {
+		return &RegisterPasswordResponse{Valid: false, Error: reasonUnsupportedAudience}, nil
 	}
-	defer tx.Rollback(ctx)
-
-	query2 := `INSERT INTO entity_tokens (entity_id, token, token_random_id, refresh_token_id, expires_at) VALUES ($1, $2, $3, $4,  $5);`
-	_, err = tx.Exec(ctx, query2, req.Entity, token, randomTokenId, refreshTokenId, tokenExpiresAt.Unix())
 
-	if err = tx.Commit(ctx); err != nil {
-		return &LoginRefreshTokenResponse{Valid: false, Error: err.Error()}, err
+	violations := dal.checkPasswordPolicy(req.Password, req.PrimaryEmail, req.PublicIdentifier)
+	if len(violations) > 0 {
+		return &RegisterPasswordResponse{PasswordViolations: violations, Valid: false, Error: reasonPasswordPolicy}, nil
 	}
 
-	return &LoginRefreshTokenResponse{
-		Entity:         req.Entity,
-		Token:          token,
-		TokenExpiresAt: tokenExpiresAt.Unix(),
-		Valid:          true,
-		Error:          "",
-	}, nil
-}
-
-func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPasswordRequest) (*RegisterPasswordResponse, error) {
 	query1 := `SELECT id FROM entities WHERE primary_email = $1;`
 
 	rows, err := dal.db.Query(ctx, query1, req.PrimaryEmail)
@@ -221,7 +360,18 @@ func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPassw
 	}
 
 	if entityID != uuid.Nil {
-		return &RegisterPasswordResponse{Valid: false, Error: "Existing email"}, nil
+		if !dal.enumerationProtection() {
+			return &RegisterPasswordResponse{Valid: false, Error: "Existing email"}, nil
+		}
+
+		// Hash anyway so that registering a known email takes as long as a new one.
+		_, err = dal.hashPassword(req.Password)
+		if err != nil {
+			return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+
+		dal.notify(ctx, Notification{Type: NotificationAlreadyRegistered, Entity: entityID, PrimaryEmail: req.PrimaryEmail})
+		return &RegisterPasswordResponse{Valid: true, Error: ""}, nil
 	}
 
 	tx, err := dal.db.Begin(ctx)
@@ -242,7 +392,7 @@ func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPassw
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	passwordHash, err := HashString(req.Password)
+	passwordHash, err := dal.hashPassword(req.Password)
 	if err != nil {
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
@@ -265,20 +415,40 @@ func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPassw
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
+	// Tokens would tell a new email apart from a registered one, so the new entity has to sign in instead.
+	if dal.enumerationProtection() {
+		if err = tx.Commit(ctx); err != nil {
+			return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+
+		dal.notify(ctx, Notification{Type: NotificationRegistered, Entity: entityID, PrimaryEmail: req.PrimaryEmail})
+		return &RegisterPasswordResponse{Valid: true, Error: ""}, nil
+	}
+
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+	evictedSessions, rejected, err := dal.enforceSessionLimit(ctx, tx, entityID, uuid.Nil, client)
+	if err != nil {
+		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	if rejected {
+		return &RegisterPasswordResponse{Valid: false, Error: reasonTooManySessions}, nil
+	}
+
 	randomRefreshTokenId, err := GetRandomAlphanumericString(32)
 	if err != nil {
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	refreshTokenExpiresAt := time.Now().UTC().Add(time.Hour * 24 * 30)
-	refreshToken, err := GenerateJWT(dal.tokenIssuer, entityID.String(), dal.tokenAudience, refreshTokenExpiresAt, time.Now().UTC(), time.Now().UTC(), randomRefreshTokenId, dal.tokenSigningKey)
+	lifetime := dal.tokenLifetime(req.ClientType, audience)
+	refreshTokenExpiresAt := time.Now().UTC().Add(lifetime.RefreshTokenTTL)
+	refreshToken, err := dal.generateRefreshToken(entityID, randomRefreshTokenId, audience, refreshTokenExpiresAt)
 	if err != nil {
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
 	entityRefreshTokenIdString := ""
-	query5 := `INSERT INTO entity_refresh_tokens (entity_id, token, token_random_id, expires_at) VALUES ($1, $2, $3, $4) RETURNING id;`
-	err = tx.QueryRow(ctx, query5, entityID, refreshToken, randomRefreshTokenId, refreshTokenExpiresAt.Unix()).Scan(&entityRefreshTokenIdString)
+	query5 := `INSERT INTO entity_refresh_tokens (entity_id, token_hash, token_random_id, client_type, audience, ip_address, user_agent, device_fingerprint, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+	err = tx.QueryRow(ctx, query5, entityID, HashToken(refreshToken), randomRefreshTokenId, req.ClientType, storedAudience(req.Audience), client.IPAddress, client.UserAgent, client.DeviceFingerprint, refreshTokenExpiresAt.Unix()).Scan(&entityRefreshTokenIdString)
 	if err != nil {
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
@@ -288,14 +458,22 @@ func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPassw
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	tokenExpiresAt := time.Now().UTC().Add(time.Minute * 15)
-	token, err := GenerateJWT(dal.tokenIssuer, entityID.String(), dal.tokenAudience, refreshTokenExpiresAt, time.Now().UTC(), time.Now().UTC(), randomTokenId, dal.tokenSigningKey)
+	entityRefreshTokenId, err := uuid.Parse(entityRefreshTokenIdString)
+	if err != nil {
+		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	tokenExpiresAt := time.Now().UTC().Add(lifetime.AccessTokenTTL)
+	token, err := dal.generateAccessToken(ctx, tx, entityID, entityRefreshTokenId, randomTokenId, audience, tokenExpiresAt)
 	if err != nil {
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	query6 := `INSERT INTO entity_tokens (entity_id, token, token_random_id, refresh_token_id, expires_at) VALUES ($1, $2, $3, $4,  $5);`
-	_, err = tx.Exec(ctx, query6, entityID, token, randomTokenId, entityRefreshTokenIdString, tokenExpiresAt.Unix())
+	query6 := `INSERT INTO entity_tokens (entity_id, token_hash, token_random_id, refresh_token_id, ip_address, user_agent, device_fingerprint, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	_, err = tx.Exec(ctx, query6, entityID, HashToken(token), randomTokenId, entityRefreshTokenId, client.IPAddress, client.UserAgent, client.DeviceFingerprint, tokenExpiresAt.Unix())
+	if err != nil {
+		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
+	}
 
 	if err = tx.Commit(ctx); err != nil {
 		return &RegisterPasswordResponse{Valid: false, Error: err.Error()}, err
@@ -307,96 +485,46 @@ func (dal *DALPostgres) RegisterPassword(ctx context.Context, req *RegisterPassw
 		TokenExpiresAt:        tokenExpiresAt.Unix(),
 		RefreshToken:          refreshToken,
 		RefreshTokenExpiresAt: refreshTokenExpiresAt.Unix(),
+		EvictedSessions:       evictedSessions,
 		Valid:                 true,
 		Error:                 "",
 	}, nil
 }
 
 func (dal *DALPostgres) RefreshToken(ctx context.Context, req *RefreshTokenRequest) (*RefreshTokenResponse, error) {
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
 
-	parsedRefreshTokenCheck, err := VerifyJWT(req.RefreshToken, dal.tokenSigningKey)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	err = ValidateJWT(parsedRefreshTokenCheck)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	query1 := `SELECT id, token, token_random_id FROM entity_refresh_tokens WHERE entity_id = $1 AND token = $2 AND active = true AND expires_at > current_epoch();`
-
-	rows, err := dal.db.Query(ctx, query1, req.Entity, req.RefreshToken)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-	defer rows.Close()
-
-	refreshTokenId := ""
-	refreshToken := ""
-	randomRefreshTokenId := ""
-	for rows.Next() {
-		err := rows.Scan(&refreshTokenId, &refreshToken, &randomRefreshTokenId)
-		if err != nil {
-			return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-		}
-	}
-
-	refreshTokenUUID, err := uuid.Parse(refreshTokenId)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	parsedRefreshToken, err := VerifyJWT(refreshToken, dal.tokenSigningKey)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	err = ValidateJWT(parsedRefreshToken)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	randomTokenId, err := GetRandomAlphanumericString(32)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	expiresAt := time.Now().UTC().Add(time.Minute * 15)
-	token, err := GenerateJWT(dal.tokenIssuer, req.Entity.String(), dal.tokenAudience, expiresAt, time.Now().UTC(), time.Now().UTC(), randomTokenId, dal.tokenSigningKey)
+	session, reason, err := dal.refreshSession(ctx, req.Entity, req.RefreshToken, client)
 	if err != nil {
 		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
 	}
 
-	tx, err := dal.db.Begin(ctx)
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-	defer tx.Rollback(ctx)
-
-	query2 := `INSERT INTO entity_tokens (entity_id, token, token_random_id, refresh_token_id, expires_at) VALUES ($1, $2, $3, $4,  $5);`
-	_, err = tx.Exec(ctx, query2, req.Entity, token, randomTokenId, refreshTokenUUID, expiresAt.Unix())
-	if err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
-	}
-
-	if err = tx.Commit(ctx); err != nil {
-		return &RefreshTokenResponse{Valid: false, Error: err.Error()}, err
+	if reason != "" {
+		return &RefreshTokenResponse{Valid: false, Error: reason}, nil
 	}
 
 	return &RefreshTokenResponse{
-		Entity:         req.Entity,
-		Token:          token,
-		TokenExpiresAt: expiresAt.Unix(),
-		Valid:          true,
-		Error:          "",
+		Entity:                req.Entity,
+		Token:                 session.Token,
+		TokenExpiresAt:        session.TokenExpiresAt.Unix(),
+		RefreshToken:          session.RefreshToken,
+		RefreshTokenExpiresAt: session.RefreshTokenExpiresAt.Unix(),
+		EvictedSessions:       session.EvictedSessions,
+		Warning:               session.Warning,
+		Valid:                 true,
+		Error:                 "",
 	}, nil
 }
 
 func (dal *DALPostgres) LogoutToken(ctx context.Context, req *LogoutTokenRequest) (*LogoutTokenResponse, error) {
-	query1 := `SELECT id FROM entity_tokens WHERE entity_id = $1 AND token = $2 AND active = true;`
+	tokenRandomId, err := dal.tokenRandomID(req.Token)
+	if err != nil {
+		return &LogoutTokenResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	query1 := `SELECT id FROM entity_tokens WHERE entity_id = $1 AND token_random_id = $2 AND token_hash = $3 AND active = true;`
 
-	rows, err := dal.db.Query(ctx, query1, req.Entity, req.Token)
+	rows, err := dal.db.Query(ctx, query1, req.Entity, tokenRandomId, HashToken(req.Token))
 	if err != nil {
 		return &LogoutTokenResponse{Valid: false, Error: err.Error()}, err
 	}
@@ -440,9 +568,14 @@ func (dal *DALPostgres) LogoutToken(ctx context.Context, req *LogoutTokenRequest
 }
 
 func (dal *DALPostgres) LogoutRefreshToken(ctx context.Context, req *LogoutRefreshTokenRequest) (*LogoutRefreshTokenResponse, error) {
-	query1 := `SELECT id FROM entity_refresh_tokens WHERE entity_id = $1 AND token = $2 AND active = true;`
+	refreshTokenRandomId, err := dal.tokenRandomID(req.RefreshToken)
+	if err != nil {
+		return &LogoutRefreshTokenResponse{Valid: false, Error: err.Error()}, err
+	}
 
-	rows, err := dal.db.Query(ctx, query1, req.Entity, req.RefreshToken)
+	query1 := `SELECT id FROM entity_refresh_tokens WHERE entity_id = $1 AND token_random_id = $2 AND token_hash = $3 AND active = true;`
+
+	rows, err := dal.db.Query(ctx, query1, req.Entity, refreshTokenRandomId, HashToken(req.RefreshToken))
 	if err != nil {
 		return &LogoutRefreshTokenResponse{Valid: false, Error: err.Error()}, err
 	}
@@ -609,7 +742,9 @@ func (dal *DALPostgres) ForgotPassword(ctx context.Context, req *ForgotPasswordR
 		}
 	}
 
-	if entityID == uuid.Nil {
+	// In enumeration protection mode an unknown email runs the same update, which matches nothing, so that
+	// it takes as long as a known one.
+	if entityID == uuid.Nil && !dal.enumerationProtection() {
 		return &ForgotPasswordResponse{Valid: false, Error: "Not found"}, nil
 	}
 
@@ -638,6 +773,20 @@ func (dal *DALPostgres) ForgotPassword(ctx context.Context, req *ForgotPasswordR
 		return &ForgotPasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 
+	// The token goes to the owner of the email only, and the caller gets the same answer as for an unknown email.
+	if dal.enumerationProtection() {
+		if entityID != uuid.Nil {
+			dal.notify(ctx, Notification{
+				Type:                        NotificationPasswordReset,
+				Entity:                      entityID,
+				PrimaryEmail:                req.PrimaryEmail,
+				PasswordResetToken:          passwordResetToken,
+				PasswordResetTokenExpiresAt: time.Now().UTC().Add(15 * time.Minute).Unix(),
+			})
+		}
+		return &ForgotPasswordResponse{Valid: true, Error: ""}, nil
+	}
+
 	return &ForgotPasswordResponse{
 		entityID,
 		passwordResetToken,
@@ -647,7 +796,7 @@ func (dal *DALPostgres) ForgotPassword(ctx context.Context, req *ForgotPasswordR
 }
 
 func (dal *DALPostgres) ChangePassword(ctx context.Context, req *ChangePasswordRequest) (*ChangePasswordResponse, error) {
-	query1 := `SELECT e.id, elmp.id 
+	query1 := `SELECT e.id, elmp.id, e.public_identifier, elmp.password_hash 
 		FROM entities e JOIN entity_login_methods elm ON e.id = elm.entity_id 
 		JOIN entity_login_method_password elmp ON elm.method_id = elmp.id
 	    WHERE e.active = true AND elm.active = true AND elmp.active = true and elm.method_type like 'entity_login_method_password'
@@ -661,9 +810,11 @@ func (dal *DALPostgres) ChangePassword(ctx context.Context, req *ChangePasswordR
 
 	var entityIDString string
 	var entityLoginPasswordIDString string
+	var publicIdentifier string
+	var currentPasswordHash string
 
 	for rows.Next() {
-		err := rows.Scan(&entityIDString, &entityLoginPasswordIDString)
+		err := rows.Scan(&entityIDString, &entityLoginPasswordIDString, &publicIdentifier, &currentPasswordHash)
 		if err != nil {
 			return &ChangePasswordResponse{Valid: false, Error: err.Error()}, err
 		}
@@ -683,13 +834,37 @@ func (dal *DALPostgres) ChangePassword(ctx context.Context, req *ChangePasswordR
 		return &ChangePasswordResponse{Valid: false, Error: "Not found"}, nil
 	}
 
+	violations := dal.checkPasswordPolicy(req.Password, req.PrimaryEmail, publicIdentifier)
+	if len(violations) > 0 {
+		return &ChangePasswordResponse{PasswordViolations: violations, Valid: false, Error: reasonPasswordPolicy}, nil
+	}
+
 	tx, err := dal.db.Begin(ctx)
 	if err != nil {
 		return &ChangePasswordResponse{Valid: false, Error: err.Error()}, err
 	}
 	defer tx.Rollback(ctx)
 
-	hashedPassword, err := HashString(req.Password)
+	recentlyUsed, err := dal.passwordRecentlyUsed(ctx, tx, entityLoginPasswordID, currentPasswordHash, req.Password)
+	if err != nil {
+		return &ChangePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	if recentlyUsed {
+		return &ChangePasswordResponse{PasswordViolations: []PasswordViolation{passwordRecentlyUsedViolation(dal.passwordHistoryDepth)}, Valid: false, Error: reasonPasswordPolicy}, nil
+	}
+
+	err = dal.recordPasswordHistory(ctx, tx, entityLoginPasswordID, currentPasswordHash)
+	if err != nil {
+		return &ChangePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	// Resetting the password proves control of the email, so it also lifts a lockout.
+	err = dal.resetFailedLogins(ctx, tx, entityID, loginMethodPassword, entityLoginPasswordID)
+	if err != nil {
+		return &ChangePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	hashedPassword, err := dal.hashPassword(req.Password)
 	if err != nil {
 		return &ChangePasswordResponse{Valid: false, Error: err.Error()}, err
 	}
@@ -776,3 +951,157 @@ func (dal *DALPostgres) GetEntityDetails(ctx context.Context, req *GetEntityDeta
 
 	return getUserDetailsResponse, nil
 }
+
+func (dal *DALPostgres) GetJWKS(ctx context.Context, req *GetJWKSRequest) (*GetJWKSResponse, error) {
+	jwks, err := NewJWKS(dal.signer.VerificationKeys())
+	if err != nil {
+		return &GetJWKSResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &GetJWKSResponse{
+		JWKS:        jwks,
+		CacheMaxAge: int64(dal.jwksCacheMaxAge().Seconds()),
+		Valid:       true,
+		Error:       "",
+	}, nil
+}
+
+func (dal *DALPostgres) jwksCacheMaxAge() time.Duration {
+	if dal.keyRing != nil {
+		return dal.keyRing.CacheMaxAge()
+	}
+	return DefaultJWKSCacheMaxAge
+}
+
+func (dal *DALPostgres) RotateSigningKey(ctx context.Context, req *RotateSigningKeyRequest) (*RotateSigningKeyResponse, error) {
+	if dal.keyRing == nil {
+		return &RotateSigningKeyResponse{Valid: false, Error: "Signing keys are not managed by a key ring"}, nil
+	}
+
+	keyID, err := dal.keyRing.Rotate(ctx)
+	if err != nil {
+		return &RotateSigningKeyResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &RotateSigningKeyResponse{
+		KeyID: keyID,
+		Valid: true,
+		Error: "",
+	}, nil
+}
+
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+func (dal *DALPostgres) IntrospectToken(ctx context.Context, req *IntrospectTokenRequest) (*IntrospectTokenResponse, error) {
+	inactive := &IntrospectTokenResponse{Active: false, Valid: true, Error: ""}
+
+	tokenRandomId, claims, err := dal.verifyToken(req.Token)
+	if err != nil {
+		return inactive, nil
+	}
+
+	tokenTypes := []string{TokenTypeAccessToken, TokenTypeRefreshToken}
+	if req.TokenTypeHint == TokenTypeRefreshToken {
+		tokenTypes = []string{TokenTypeRefreshToken, TokenTypeAccessToken}
+	}
+
+	// An access token is only active while the session (refresh token) it was issued from is not revoked.
+	// Rotated refresh tokens are retired, not revoked, so their access tokens stay valid until they expire.
+	query1 := `SELECT et.entity_id, et.refresh_token_id, et.created_at, et.expires_at, COALESCE(e.is_verified, false), e.public_identifier
+				FROM entity_tokens et
+				JOIN entity_refresh_tokens ert ON et.refresh_token_id = ert.id
+				JOIN entities e ON et.entity_id = e.id
+				WHERE et.token_random_id = $1 AND et.token_hash = $2
+				AND et.active = true AND et.expires_at > current_epoch() AND ert.revoked_at IS NULL AND e.active = true;`
+
+	query2 := `SELECT ert.entity_id, ert.id, ert.created_at, ert.expires_at, COALESCE(e.is_verified, false), e.public_identifier
+				FROM entity_refresh_tokens ert
+				JOIN entities e ON ert.entity_id = e.id
+				WHERE ert.token_random_id = $1 AND ert.token_hash = $2
+				AND ert.active = true AND ert.expires_at > current_epoch() AND e.active = true;`
+
+	for _, tokenType := range tokenTypes {
+		query := query1
+		if tokenType == TokenTypeRefreshToken {
+			query = query2
+		}
+
+		rows, err := dal.db.Query(ctx, query, tokenRandomId, HashToken(req.Token))
+		if err != nil {
+			return &IntrospectTokenResponse{Valid: false, Error: err.Error()}, err
+		}
+
+		found := false
+		var entityID, sessionID uuid.UUID
+		var createdAt, expiresAt int64
+		emailVerified := false
+		publicIdentifier := ""
+		for rows.Next() {
+			err := rows.Scan(&entityID, &sessionID, &createdAt, &expiresAt, &emailVerified, &publicIdentifier)
+			if err != nil {
+				rows.Close()
+				return &IntrospectTokenResponse{Valid: false, Error: err.Error()}, err
+			}
+			found = true
+		}
+		rows.Close()
+
+		if !found {
+			continue
+		}
+
+		if claims != nil {
+			if claims.Subject != entityID.String() {
+				return inactive, nil
+			}
+			return newIntrospectTokenResponse(claims, tokenType), nil
+		}
+
+		return &IntrospectTokenResponse{
+			Active:        true,
+			TokenType:     tokenType,
+			Subject:       entityID.String(),
+			Username:      publicIdentifier,
+			Issuer:        dal.tokenIssuer,
+			Audience:      dal.tokenAudience,
+			ExpiresAt:     expiresAt,
+			IssuedAt:      createdAt,
+			JWTID:         tokenRandomId,
+			EmailVerified: &emailVerified,
+			SessionID:     sessionID.String(),
+			Valid:         true,
+			Error:         "",
+		}, nil
+	}
+
+	return inactive, nil
+}
+
+func newIntrospectTokenResponse(claims *AccessTokenClaims, tokenType string) *IntrospectTokenResponse {
+	res := &IntrospectTokenResponse{
+		Active:        true,
+		TokenType:     tokenType,
+		Subject:       claims.Subject,
+		Username:      claims.PublicIdentifier,
+		Issuer:        claims.Issuer,
+		Audience:      claims.Audience,
+		JWTID:         claims.ID,
+		EmailVerified: claims.EmailVerified,
+		SessionID:     claims.SessionID,
+		Valid:         true,
+		Error:         "",
+	}
+	if claims.ExpiresAt != nil {
+		res.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		res.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		res.NotBefore = claims.NotBefore.Unix()
+	}
+	return res
+}
@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"testing"
+	"time"
 )
 
 func TestDal(t *testing.T) {
 
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -40,7 +41,7 @@ func TestDal(t *testing.T) {
 func TestLoginPassword(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -76,7 +77,7 @@ var refreshToken string = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJpc3MiOiJodHRw
 func TestLoginRefreshToken(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -110,7 +111,7 @@ func TestLoginRefreshToken(t *testing.T) {
 func TestRefreshToken(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -143,7 +144,7 @@ func TestRefreshToken(t *testing.T) {
 func TestLogout(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -203,7 +204,7 @@ func TestLogout(t *testing.T) {
 func TestVerify(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -248,7 +249,7 @@ func TestVerify(t *testing.T) {
 func TestChangePassword(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -292,7 +293,7 @@ func TestChangePassword(t *testing.T) {
 func TestGetEntityDetail(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -322,7 +323,7 @@ func TestGetEntityDetail(t *testing.T) {
 func TestDeleteEntity(t *testing.T) {
 	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
 
-	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), "1234")
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -349,3 +350,842 @@ func TestDeleteEntity(t *testing.T) {
 
 	fmt.Println(res.Entity)
 }
+
+func TestRotateSigningKey(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgresWithKeyRing(connStr, "https://test.com", make([]string, 0), DefaultKeyRotationPolicy, testSigningKeyEncryption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	previousKeyID := dal.keyRing.KeyID()
+	previousToken, err := GenerateJWT("https://test.com", entity, nil, time.Now().UTC().Add(time.Minute), time.Now().UTC(), time.Now().UTC(), "jti", dal.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dal.RotateSigningKey(context.Background(), &RotateSigningKeyRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Valid || res.Error != "" || res.KeyID == previousKeyID {
+		t.Fatal("expected a new active signing key")
+	}
+
+	if _, err := VerifyJWT(previousToken, dal.signer); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := dal.GetJWKS(context.Background(), &GetJWKSRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Println(jwks.JWKS)
+}
+
+func TestIntrospectToken(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dal.IntrospectToken(context.Background(), &IntrospectTokenRequest{Token: resLogin.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Active || res.TokenType != TokenTypeAccessToken {
+		t.Fatal("expected active access token")
+	}
+
+	_, err = dal.LogoutToken(context.Background(), &LogoutTokenRequest{Entity: resLogin.Entity, Token: resLogin.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = dal.IntrospectToken(context.Background(), &IntrospectTokenRequest{Token: resLogin.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Active {
+		t.Fatal("expected revoked token to be inactive")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithRefreshTokenRotation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resRefresh, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{
+		Entity:       resLogin.Entity,
+		RefreshToken: resLogin.RefreshToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resRefresh.Valid || resRefresh.RefreshToken == resLogin.RefreshToken {
+		t.Fatal("expected a rotated refresh token")
+	}
+
+	resReuse, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{
+		Entity:       resLogin.Entity,
+		RefreshToken: resLogin.RefreshToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resReuse.Valid {
+		t.Fatal("expected reuse of a retired refresh token to be refused")
+	}
+
+	resAfterReuse, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{
+		Entity:       resLogin.Entity,
+		RefreshToken: resRefresh.RefreshToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resAfterReuse.Valid {
+		t.Fatal("expected the whole token family to be revoked")
+	}
+}
+
+func TestUnknownAudience(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	policy := TokenLifetimePolicy{
+		Default:   TokenLifetime{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: 24 * time.Hour},
+		Audiences: map[string]TokenLifetime{"https://admin.test.com": {AccessTokenTTL: 5 * time.Minute, RefreshTokenTTL: time.Hour}},
+	}
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithTokenLifetimePolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resUnknown, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+		Audience:   "https://other.test.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resUnknown.Valid || resUnknown.Error != reasonUnsupportedAudience {
+		t.Fatal("expected an audience unknown to the lifetime policy to be refused")
+	}
+
+	resKnown, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+		Audience:   "https://admin.test.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resKnown.Valid {
+		t.Fatal(resKnown.Error)
+	}
+}
+
+func TestOpaqueTokens(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithTokenFormat(TokenFormatOpaque))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resRefresh, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{
+		Entity:       resLogin.Entity,
+		RefreshToken: resLogin.RefreshToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resRefresh.Valid || resRefresh.Error != "" {
+		t.Fatal("expected invalid response")
+	}
+
+	resLogout, err := dal.LogoutRefreshToken(context.Background(), &LogoutRefreshTokenRequest{
+		Entity:       resLogin.Entity,
+		RefreshToken: resLogin.RefreshToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resLogout.Valid || resLogout.Error != "" {
+		t.Fatal("expected invalid response")
+	}
+
+	res, err := dal.IntrospectToken(context.Background(), &IntrospectTokenRequest{Token: resRefresh.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Active {
+		t.Fatal("expected token of a revoked session to be inactive")
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dal.ListSessions(context.Background(), &ListSessionsRequest{Entity: resLogin.Entity, Token: resLogin.Token, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Valid {
+		t.Fatal(res.Error)
+	}
+
+	current := 0
+	for _, session := range res.Sessions {
+		if session.Current {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Fatalf("expected exactly one current session, got %d", current)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := VerifyJWT(resLogin.Token, dal.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dal.RevokeSession(context.Background(), &RevokeSessionRequest{Entity: resLogin.Entity, Session: session})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Valid {
+		t.Fatal(res.Error)
+	}
+
+	resIntrospect, err := dal.IntrospectToken(context.Background(), &IntrospectTokenRequest{Token: resLogin.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resIntrospect.Active {
+		t.Fatal("expected access token of revoked session to be inactive")
+	}
+
+	resRefresh, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{Entity: resLogin.Entity, RefreshToken: resLogin.RefreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resRefresh.Valid {
+		t.Fatal("expected refresh token of revoked session to be refused")
+	}
+}
+
+func TestSessionLimit(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithSessionLimit(1, SessionLimitEvictLeastRecentlyUsed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resFirst, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resSecond, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resSecond.Valid || len(resSecond.EvictedSessions) == 0 {
+		t.Fatal("expected the first session to be evicted")
+	}
+
+	resRefresh, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{Entity: resFirst.Entity, RefreshToken: resFirst.RefreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resRefresh.Valid {
+		t.Fatal("expected evicted session to be refused")
+	}
+
+	rejectingDal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithSessionLimit(1, SessionLimitReject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejectingDal.Close()
+
+	resRejected, err := rejectingDal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resRejected.Valid {
+		t.Fatal("expected login over the session limit to be rejected")
+	}
+}
+
+func TestSessionClientContext(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	ipAddress := "192.0.2.1"
+	userAgent := "test-agent"
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+		IPAddress:  &ipAddress,
+		UserAgent:  &userAgent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dal.RefreshToken(context.Background(), &RefreshTokenRequest{Entity: resLogin.Entity, RefreshToken: resLogin.RefreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dal.ListSessions(context.Background(), &ListSessionsRequest{Entity: resLogin.Entity, Token: resLogin.RefreshToken, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, session := range res.Sessions {
+		if !session.Current {
+			continue
+		}
+		if session.IPAddress == nil || *session.IPAddress != ipAddress || session.UserAgent == nil || *session.UserAgent != userAgent {
+			t.Fatal("expected client context to be stored with the session")
+		}
+		if session.LastUsedAt == nil {
+			t.Fatal("expected last_used_at to be set after a refresh")
+		}
+		return
+	}
+
+	t.Fatal("current session not listed")
+}
+
+func TestDeviceBindingWarn(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	policy := DeviceBindingPolicy{Mode: DeviceBindingWarn, IPv4PrefixLength: 24}
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithRefreshTokenRotation(), WithDeviceBinding(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	boundIPAddress := "192.0.2.1"
+	resLogin, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{
+		Identifier: "1234@email.com",
+		Password:   "1234",
+		IPAddress:  &boundIPAddress,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rotated token stays bound to the original subnet, so every refresh from elsewhere is warned about.
+	foreignIPAddress := "198.51.100.1"
+	refreshToken := resLogin.RefreshToken
+	for i := 0; i < 2; i++ {
+		resRefresh, err := dal.RefreshToken(context.Background(), &RefreshTokenRequest{
+			Entity:       resLogin.Entity,
+			RefreshToken: refreshToken,
+			IPAddress:    &foreignIPAddress,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !resRefresh.Valid || resRefresh.Warning == "" {
+			t.Fatalf("refresh %d: expected a device mismatch warning", i+1)
+		}
+		refreshToken = resRefresh.RefreshToken
+	}
+}
+
+func TestRegisterPasswordPolicy(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithPasswordPolicy(DefaultPasswordPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	res, err := dal.RegisterPassword(context.Background(), &RegisterPasswordRequest{
+		Password:         "1234",
+		PrimaryEmail:     "policy@email.com",
+		PublicIdentifier: "policy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Valid || len(res.PasswordViolations) == 0 {
+		t.Fatal("expected weak password to be refused with violations")
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithPasswordHistory(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	email := uuid.New().String() + "@email.com"
+	resRegister, err := dal.RegisterPassword(context.Background(), &RegisterPasswordRequest{
+		Password:         "first-password",
+		PrimaryEmail:     email,
+		PublicIdentifier: "history",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resRegister.Valid {
+		t.Fatal(resRegister.Error)
+	}
+
+	changePassword := func(password string) *ChangePasswordResponse {
+		resForgotPassword, err := dal.ForgotPassword(context.Background(), &ForgotPasswordRequest{PrimaryEmail: email})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resChangePassword, err := dal.ChangePassword(context.Background(), &ChangePasswordRequest{
+			PrimaryEmail:       email,
+			PasswordResetToken: resForgotPassword.PasswordResetToken,
+			Password:           password,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resChangePassword
+	}
+
+	if res := changePassword("second-password"); !res.Valid {
+		t.Fatal(res.Error)
+	}
+
+	res := changePassword("first-password")
+	if res.Valid || len(res.PasswordViolations) != 1 || res.PasswordViolations[0].Code != PasswordViolationRecentlyUsed {
+		t.Fatal("expected a recently used password to be refused")
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	email := uuid.New().String() + "@email.com"
+	resRegister, err := dal.RegisterPassword(context.Background(), &RegisterPasswordRequest{
+		Password:         "first-password",
+		PrimaryEmail:     email,
+		PublicIdentifier: "update",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resOther, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "first-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := dal.UpdatePassword(context.Background(), &UpdatePasswordRequest{
+		Entity:          resRegister.Entity,
+		CurrentPassword: "wrong-password",
+		NewPassword:     "second-password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Valid {
+		t.Fatal("expected wrong current password to be refused")
+	}
+
+	res, err = dal.UpdatePassword(context.Background(), &UpdatePasswordRequest{
+		Entity:              resRegister.Entity,
+		CurrentPassword:     "first-password",
+		NewPassword:         "second-password",
+		RevokeOtherSessions: true,
+		Token:               resRegister.Token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Valid || res.RevokedSessions != 1 {
+		t.Fatal("expected the other session to be revoked")
+	}
+
+	resCurrent, err := dal.IntrospectToken(context.Background(), &IntrospectTokenRequest{Token: resRegister.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resRevoked, err := dal.IntrospectToken(context.Background(), &IntrospectTokenRequest{Token: resOther.Token})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resCurrent.Active || resRevoked.Active {
+		t.Fatal("expected only the current session to stay signed in")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	policy := LockoutPolicy{MaxFailedAttempts: 3, MaxEntityFailedAttempts: 10, LockDuration: time.Minute, MaxLockDuration: time.Hour}
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithLockoutPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	email := uuid.New().String() + "@email.com"
+	resRegister, err := dal.RegisterPassword(context.Background(), &RegisterPasswordRequest{
+		Password:         "1234",
+		PrimaryEmail:     email,
+		PublicIdentifier: "lockout",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "wrong"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Valid || res.ErrorCode != ErrorCodeInvalidCredentials {
+			t.Fatalf("attempt %d: expected incorrect password, got %+v", i+1, res)
+		}
+	}
+
+	res, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.ErrorCode != ErrorCodeAccountLocked || res.LockedUntil <= time.Now().Unix() {
+		t.Fatalf("expected the third failure to lock the login, got %+v", res)
+	}
+
+	res, err = dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Valid || res.ErrorCode != ErrorCodeAccountLocked {
+		t.Fatal("expected the correct password to be refused while locked")
+	}
+
+	resUnlock, err := dal.UnlockEntity(context.Background(), &UnlockEntityRequest{Entity: resRegister.Entity, Reason: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resUnlock.Valid {
+		t.Fatal(resUnlock.Error)
+	}
+
+	res, err = dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Valid {
+		t.Fatalf("expected login after unlock, got %s", res.Error)
+	}
+}
+
+func TestEnumerationProtection(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	notifications := make(chan Notification, 10)
+	notifier := NotifierFunc(func(ctx context.Context, notification Notification) error {
+		notifications <- notification
+		return nil
+	})
+	nextNotification := func() Notification {
+		select {
+		case notification := <-notifications:
+			return notification
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a notification")
+			return Notification{}
+		}
+	}
+
+	lockout := LockoutPolicy{MaxFailedAttempts: 2, LockDuration: time.Minute, MaxLockDuration: time.Minute}
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithEnumerationProtection(notifier), WithLockoutPolicy(lockout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	email := uuid.New().String() + "@email.com"
+	for i := 0; i < 2; i++ {
+		res, err := dal.RegisterPassword(context.Background(), &RegisterPasswordRequest{
+			Password:         "1234",
+			PrimaryEmail:     email,
+			PublicIdentifier: "enumeration",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !res.Valid || res.Entity != uuid.Nil || res.Token != "" {
+			t.Fatalf("registration %d: expected a uniform response, got %+v", i+1, res)
+		}
+	}
+
+	if first, second := nextNotification(), nextNotification(); first.Type != NotificationRegistered || second.Type != NotificationAlreadyRegistered {
+		t.Fatalf("unexpected notifications %+v, %+v", first, second)
+	}
+
+	resUnknown, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: uuid.New().String() + "@email.com", Password: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resWrong, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resUnknown.Error != resWrong.Error || resUnknown.ErrorCode != resWrong.ErrorCode {
+		t.Fatalf("unknown identifier answered %q, wrong password %q", resUnknown.Error, resWrong.Error)
+	}
+
+	// The second failure locks the account, which only its owner is told about.
+	for i := 0; i < 2; i++ {
+		resLocked, err := dal.LoginPassword(context.Background(), &LoginPasswordRequest{Identifier: email, Password: "wrong"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resLocked.Error != resUnknown.Error || resLocked.ErrorCode != resUnknown.ErrorCode || resLocked.LockedUntil != 0 {
+			t.Fatalf("locked account answered %+v, unknown identifier %+v", resLocked, resUnknown)
+		}
+	}
+	if locked := nextNotification(); locked.Type != NotificationAccountLocked || locked.LockedUntil == 0 {
+		t.Fatalf("expected a lock notification, got %+v", locked)
+	}
+
+	resForgotUnknown, err := dal.ForgotPassword(context.Background(), &ForgotPasswordRequest{PrimaryEmail: uuid.New().String() + "@email.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resForgot, err := dal.ForgotPassword(context.Background(), &ForgotPasswordRequest{PrimaryEmail: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *resForgotUnknown != *resForgot || resForgot.PasswordResetToken != "" {
+		t.Fatalf("forgot password answered %+v for an unknown email and %+v for a known one", resForgotUnknown, resForgot)
+	}
+
+	if reset := nextNotification(); reset.Type != NotificationPasswordReset || reset.PasswordResetToken == "" {
+		t.Fatal("expected the password reset token to be sent as a notification")
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	connStr := "user=internal-authentication-db-app-user password=internal-authentication-db-app-user host=internal-authentication-db-rw.testing-dev port=5432 dbname=app sslmode=disable"
+
+	keys := EncryptionKeys{Provider: mapSecretProvider{"totp-encryption-key-v1": "test-key-0123456789"}, Name: DefaultTOTPEncryptionKeyName, CurrentVersion: 1}
+	dal, err := NewAuthenticationDALPostgres(connStr, "https://test.com", make([]string, 0), newTestSigner(t), WithTOTP(DefaultTOTPPolicy, keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dal.Close()
+
+	resRegister, err := dal.RegisterPassword(context.Background(), &RegisterPasswordRequest{
+		Password:         "1234",
+		PrimaryEmail:     uuid.New().String() + "@email.com",
+		PublicIdentifier: "totp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resEnroll, err := dal.EnrollTOTP(context.Background(), &EnrollTOTPRequest{Entity: resRegister.Entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resEnroll.Valid || resEnroll.URI == "" {
+		t.Fatal(resEnroll.Error)
+	}
+
+	secret, err := totpSecretEncoding.DecodeString(resEnroll.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCode(secret, time.Now().Unix()/30, 6)
+
+	resVerify, err := dal.VerifyTOTP(context.Background(), &VerifyTOTPRequest{Entity: resRegister.Entity, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resVerify.Valid {
+		t.Fatal("expected verification before confirmation to be refused")
+	}
+
+	resConfirm, err := dal.ConfirmTOTP(context.Background(), &ConfirmTOTPRequest{Entity: resRegister.Entity, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resConfirm.Valid {
+		t.Fatal(resConfirm.Error)
+	}
+
+	resVerify, err = dal.VerifyTOTP(context.Background(), &VerifyTOTPRequest{Entity: resRegister.Entity, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resVerify.Valid {
+		t.Fatal("expected the code used for confirmation to be refused as a replay")
+	}
+
+	nextCode := totpCode(secret, time.Now().Unix()/30+1, 6)
+	resVerify, err = dal.VerifyTOTP(context.Background(), &VerifyTOTPRequest{Entity: resRegister.Entity, Code: nextCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resVerify.Valid {
+		t.Fatalf("expected a code within the drift window to be accepted, got %s", resVerify.Error)
+	}
+
+	resDisable, err := dal.DisableTOTP(context.Background(), &DisableTOTPRequest{Entity: resRegister.Entity, Code: nextCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resDisable.Valid {
+		t.Fatal("expected a replayed code to be refused when disabling")
+	}
+}
@@ -0,0 +1,79 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var reservedClaims = map[string]struct{}{
+	"iss": {}, "sub": {}, "aud": {}, "exp": {}, "nbf": {}, "iat": {}, "jti": {},
+	"email_verified": {}, "public_identifier": {}, "sid": {},
+}
+
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+
+	EmailVerified    *bool  `json:"email_verified,omitempty"`
+	PublicIdentifier string `json:"public_identifier,omitempty"`
+	// SessionID is the entity_refresh_tokens row the token was issued from.
+	SessionID string `json:"sid,omitempty"`
+
+	// Custom claims are flattened into the token payload. Reserved claim names are ignored.
+	Custom map[string]interface{} `json:"-"`
+}
+
+// ClaimsEnricher adds claims to every access token issued for an entity.
+type ClaimsEnricher func(ctx context.Context, entity uuid.UUID, claims *AccessTokenClaims) error
+
+type accessTokenClaimsJSON AccessTokenClaims
+
+func (c AccessTokenClaims) MarshalJSON() ([]byte, error) {
+	payload, err := json.Marshal(accessTokenClaimsJSON(c))
+	if err != nil || len(c.Custom) == 0 {
+		return payload, err
+	}
+
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &merged); err != nil {
+		return nil, err
+	}
+
+	for name, value := range c.Custom {
+		if _, reserved := reservedClaims[name]; reserved {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		merged[name] = raw
+	}
+
+	return json.Marshal(merged)
+}
+
+func (c *AccessTokenClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*accessTokenClaimsJSON)(c)); err != nil {
+		return err
+	}
+
+	all := make(map[string]interface{})
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	c.Custom = nil
+	for name, value := range all {
+		if _, reserved := reservedClaims[name]; reserved {
+			continue
+		}
+		if c.Custom == nil {
+			c.Custom = make(map[string]interface{})
+		}
+		c.Custom[name] = value
+	}
+	return nil
+}
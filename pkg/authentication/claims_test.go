@@ -0,0 +1,51 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAccessTokenClaimsRoundTrip(t *testing.T) {
+	signer := newTestSigner(t)
+
+	now := time.Now().UTC()
+	emailVerified := true
+	claims := &AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://test.com",
+			Subject:   entity,
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti",
+		},
+		EmailVerified:    &emailVerified,
+		PublicIdentifier: "test",
+		SessionID:        "0b8f5a3e-4b8e-4d0a-9a43-5d0b4c1f8a11",
+		Custom: map[string]interface{}{
+			"tenant": "acme",
+			"sub":    "must-not-override",
+		},
+	}
+
+	token, err := GenerateJWTWithClaims(claims, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := VerifyJWT(token, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Subject != entity || parsed.SessionID != claims.SessionID || parsed.PublicIdentifier != "test" {
+		t.Fatalf("unexpected claims: %+v", parsed)
+	}
+	if parsed.EmailVerified == nil || !*parsed.EmailVerified {
+		t.Fatal("expected email_verified claim")
+	}
+	if parsed.Custom["tenant"] != "acme" || len(parsed.Custom) != 1 {
+		t.Fatalf("unexpected custom claims: %v", parsed.Custom)
+	}
+}
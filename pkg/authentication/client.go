@@ -17,6 +17,17 @@ type IClient interface {
 	ChangePassword(req *ChangePasswordRequest) (*ChangePasswordResponse, error)
 	DeleteEntity(req *DeleteEntityRequest) (*DeleteEntityResponse, error)
 	GetEntityDetails(req *GetEntityDetailsRequest) (*GetEntityDetailsResponse, error)
+	GetJWKS(req *GetJWKSRequest) (*GetJWKSResponse, error)
+	RotateSigningKey(req *RotateSigningKeyRequest) (*RotateSigningKeyResponse, error)
+	IntrospectToken(req *IntrospectTokenRequest) (*IntrospectTokenResponse, error)
+	ListSessions(req *ListSessionsRequest) (*ListSessionsResponse, error)
+	RevokeSession(req *RevokeSessionRequest) (*RevokeSessionResponse, error)
+	UpdatePassword(req *UpdatePasswordRequest) (*UpdatePasswordResponse, error)
+	UnlockEntity(req *UnlockEntityRequest) (*UnlockEntityResponse, error)
+	EnrollTOTP(req *EnrollTOTPRequest) (*EnrollTOTPResponse, error)
+	ConfirmTOTP(req *ConfirmTOTPRequest) (*ConfirmTOTPResponse, error)
+	VerifyTOTP(req *VerifyTOTPRequest) (*VerifyTOTPResponse, error)
+	DisableTOTP(req *DisableTOTPRequest) (*DisableTOTPResponse, error)
 }
 
 type Client struct {
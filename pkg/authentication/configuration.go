@@ -0,0 +1,56 @@
+package authentication
+
+import (
+	"fmt"
+)
+
+// ConfigurationGetter looks up a configuration value by key, like core's Configuration.Get.
+type ConfigurationGetter func(key string) (string, error)
+
+// NewAuthenticationDALPostgresFromConfiguration opens a DAL that signs with the key ring, reading the
+// settings every function shares from configuration:
+//
+//	internal-authentication-db                 database connection string
+//	authentication-signing-key-encryption-key  seals signing private keys, see ParseEncryptionKeys
+//	authentication-token-lifetimes             optional, see ParseTokenLifetimePolicy
+//
+// opts are applied after the token lifetime policy.
+func NewAuthenticationDALPostgresFromConfiguration(get ConfigurationGetter, tokenIssuer string, tokenAudience []string, opts ...DALOption) (*DALPostgres, error) {
+	connString, err := get("internal-authentication-db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection string: %w", err)
+	}
+
+	rotationPolicy, signingKeys, lifetimeOpts, err := keyRingConfiguration(get)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAuthenticationDALPostgresWithKeyRing(connString, tokenIssuer, tokenAudience, rotationPolicy, signingKeys, append(lifetimeOpts, opts...)...)
+}
+
+// keyRingConfiguration reads the key ring settings. Keys rotated by any function must keep verifying the
+// longest-lived tokens, so the rotation policy always covers the configured token lifetimes.
+func keyRingConfiguration(get ConfigurationGetter) (KeyRotationPolicy, EncryptionKeys, []DALOption, error) {
+	rotationPolicy := DefaultKeyRotationPolicy
+	opts := make([]DALOption, 0)
+	if lifetimes, err := get("authentication-token-lifetimes"); err == nil && lifetimes != "" {
+		policy, err := ParseTokenLifetimePolicy(lifetimes)
+		if err != nil {
+			return KeyRotationPolicy{}, EncryptionKeys{}, nil, fmt.Errorf("failed to parse token lifetime policy: %w", err)
+		}
+		opts = append(opts, WithTokenLifetimePolicy(policy))
+		rotationPolicy = rotationPolicy.CoveringLifetimes(policy)
+	}
+
+	signingKeysConfig, err := get("authentication-signing-key-encryption-key")
+	if err != nil || signingKeysConfig == "" {
+		return KeyRotationPolicy{}, EncryptionKeys{}, nil, fmt.Errorf("signing keys need authentication-signing-key-encryption-key")
+	}
+	signingKeys, err := ParseEncryptionKeys(signingKeysConfig, DefaultSigningKeyEncryptionKeyName)
+	if err != nil {
+		return KeyRotationPolicy{}, EncryptionKeys{}, nil, fmt.Errorf("failed to load signing key encryption key: %w", err)
+	}
+
+	return rotationPolicy, signingKeys, opts, nil
+}
@@ -0,0 +1,53 @@
+package authentication
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyRingConfiguration(t *testing.T) {
+	t.Setenv("AUTHENTICATION_SIGNING_KEY_ENCRYPTION_KEY_V1", "signing-key-secret-0123456789")
+
+	config := map[string]string{
+		"authentication-signing-key-encryption-key": `{"provider": "env", "path": "AUTHENTICATION_", "current_version": 1}`,
+	}
+	get := func(key string) (string, error) {
+		value, ok := config[key]
+		if !ok {
+			return "", errors.New("not configured")
+		}
+		return value, nil
+	}
+
+	rotationPolicy, signingKeys, opts, err := keyRingConfiguration(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotationPolicy != DefaultKeyRotationPolicy || len(opts) != 0 {
+		t.Fatalf("rotation policy = %+v, %d options without token lifetimes", rotationPolicy, len(opts))
+	}
+	if signingKeys.Name != DefaultSigningKeyEncryptionKeyName || signingKeys.CurrentVersion != 1 {
+		t.Fatalf("signing keys = %+v", signingKeys)
+	}
+
+	config["authentication-token-lifetimes"] = `{"client_types": {"mobile": {"refresh_token_ttl": "8760h"}}}`
+	rotationPolicy, _, opts, err = keyRingConfiguration(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotationPolicy.VerificationPeriod != 365*24*time.Hour || len(opts) != 1 {
+		t.Fatalf("verification period = %s, %d options", rotationPolicy.VerificationPeriod, len(opts))
+	}
+
+	config["authentication-token-lifetimes"] = `{"default": {"access_token_ttl": "-1m"}}`
+	if _, _, _, err := keyRingConfiguration(get); err == nil {
+		t.Fatal("invalid token lifetimes accepted")
+	}
+
+	delete(config, "authentication-token-lifetimes")
+	delete(config, "authentication-signing-key-encryption-key")
+	if _, _, _, err := keyRingConfiguration(get); err == nil {
+		t.Fatal("missing signing key encryption key accepted")
+	}
+}
@@ -0,0 +1,116 @@
+package authentication
+
+import (
+	"context"
+	"net"
+
+	"github.com/google/uuid"
+)
+
+type DeviceBindingMode string
+
+const (
+	DeviceBindingOff DeviceBindingMode = "off"
+	// DeviceBindingWarn lets the refresh through but reports the mismatch.
+	DeviceBindingWarn DeviceBindingMode = "warn"
+	// DeviceBindingEnforce refuses refreshes from another device.
+	DeviceBindingEnforce DeviceBindingMode = "enforce"
+)
+
+func (m DeviceBindingMode) IsValid() bool {
+	switch m {
+	case "", DeviceBindingOff, DeviceBindingWarn, DeviceBindingEnforce:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceBindingPolicy compares the client refreshing a session with the one the refresh token was issued to.
+// Values that were not recorded at issuance are not compared.
+type DeviceBindingPolicy struct {
+	Mode DeviceBindingMode `json:"mode"`
+
+	MatchDeviceFingerprint bool `json:"device_fingerprint"`
+	// Prefix lengths the IP addresses must share, e.g. 24 and 64. Zero skips the IP comparison for that family.
+	IPv4PrefixLength int `json:"ipv4_prefix_length"`
+	IPv6PrefixLength int `json:"ipv6_prefix_length"`
+
+	// RevokeOnMismatch revokes the whole session when enforcing, in case the refresh token was stolen.
+	RevokeOnMismatch bool `json:"revoke_on_mismatch"`
+}
+
+const reasonDeviceMismatch = "Refresh token was issued to another device"
+
+// deviceMismatch describes how client differs from the device a refresh token is bound to, or is empty.
+func (p DeviceBindingPolicy) deviceMismatch(boundIPAddress *string, boundDeviceFingerprint *string, client clientContext) string {
+	if p.Mode == "" || p.Mode == DeviceBindingOff {
+		return ""
+	}
+
+	if p.MatchDeviceFingerprint && boundDeviceFingerprint != nil {
+		if client.DeviceFingerprint == nil || *client.DeviceFingerprint != *boundDeviceFingerprint {
+			return "device fingerprint mismatch"
+		}
+	}
+
+	if boundIPAddress != nil && (p.IPv4PrefixLength > 0 || p.IPv6PrefixLength > 0) {
+		if client.IPAddress == nil || !p.sameSubnet(*boundIPAddress, *client.IPAddress) {
+			return "ip subnet mismatch"
+		}
+	}
+
+	return ""
+}
+
+func (p DeviceBindingPolicy) sameSubnet(bound string, presented string) bool {
+	boundIP := net.ParseIP(bound)
+	presentedIP := net.ParseIP(presented)
+	if boundIP == nil || presentedIP == nil {
+		return false
+	}
+
+	if boundIP4, presentedIP4 := boundIP.To4(), presentedIP.To4(); boundIP4 != nil || presentedIP4 != nil {
+		if boundIP4 == nil || presentedIP4 == nil {
+			return false
+		}
+		if p.IPv4PrefixLength <= 0 {
+			return true
+		}
+		mask := net.CIDRMask(p.IPv4PrefixLength, 32)
+		return boundIP4.Mask(mask).Equal(presentedIP4.Mask(mask))
+	}
+
+	if p.IPv6PrefixLength <= 0 {
+		return true
+	}
+	mask := net.CIDRMask(p.IPv6PrefixLength, 128)
+	return boundIP.Mask(mask).Equal(presentedIP.Mask(mask))
+}
+
+// refuseDeviceMismatch records the refused refresh and, if the policy says so, revokes the session.
+func (dal *DALPostgres) refuseDeviceMismatch(ctx context.Context, entityID uuid.UUID, familyID uuid.UUID, mismatch string, client clientContext) (*refreshedSession, string, error) {
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	if dal.deviceBinding.RevokeOnMismatch {
+		err = revokeSessionFamily(ctx, tx, familyID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	err = dal.recordSecurityEvent(ctx, tx, entityID, SecurityEventDeviceMismatch, mismatch+", family_id="+familyID.String()+", mode=enforce", client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, "", err
+	}
+
+	return nil, reasonDeviceMismatch, nil
+}
@@ -0,0 +1,41 @@
+package authentication
+
+import "testing"
+
+func TestDeviceBindingPolicy(t *testing.T) {
+	policy := DeviceBindingPolicy{Mode: DeviceBindingEnforce, MatchDeviceFingerprint: true, IPv4PrefixLength: 24, IPv6PrefixLength: 64}
+
+	fingerprint := "device-a"
+	otherFingerprint := "device-b"
+	ip := "192.0.2.10"
+	sameSubnetIP := "192.0.2.200"
+	otherSubnetIP := "198.51.100.10"
+	ipv6 := "2001:db8:1:2::1"
+	sameSubnetIPv6 := "2001:db8:1:2:ffff::1"
+
+	cases := []struct {
+		name        string
+		ip          *string
+		fingerprint *string
+		client      clientContext
+		mismatch    bool
+	}{
+		{"same device", &ip, &fingerprint, clientContext{IPAddress: &sameSubnetIP, DeviceFingerprint: &fingerprint}, false},
+		{"other fingerprint", &ip, &fingerprint, clientContext{IPAddress: &ip, DeviceFingerprint: &otherFingerprint}, true},
+		{"missing fingerprint", &ip, &fingerprint, clientContext{IPAddress: &ip}, true},
+		{"other subnet", &ip, &fingerprint, clientContext{IPAddress: &otherSubnetIP, DeviceFingerprint: &fingerprint}, true},
+		{"ipv6 same subnet", &ipv6, nil, clientContext{IPAddress: &sameSubnetIPv6}, false},
+		{"ipv4 to ipv6", &ip, nil, clientContext{IPAddress: &ipv6}, true},
+		{"nothing bound", nil, nil, clientContext{IPAddress: &otherSubnetIP}, false},
+	}
+	for _, c := range cases {
+		if got := policy.deviceMismatch(c.ip, c.fingerprint, c.client) != ""; got != c.mismatch {
+			t.Errorf("%s: mismatch = %v, want %v", c.name, got, c.mismatch)
+		}
+	}
+
+	off := DeviceBindingPolicy{Mode: DeviceBindingOff, MatchDeviceFingerprint: true}
+	if off.deviceMismatch(nil, &fingerprint, clientContext{DeviceFingerprint: &otherFingerprint}) != "" {
+		t.Fatal("mismatch reported with binding off")
+	}
+}
@@ -0,0 +1,97 @@
+package authentication
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// EncryptionKeys seal values stored in the database with AES-256-GCM, under keys from a SecretProvider.
+// Sealed values record the key version, so after CurrentVersion is raised older values stay readable as
+// long as their key is available.
+type EncryptionKeys struct {
+	Provider SecretProvider
+	// Keys are read as <Name>-v<version>, e.g. totp-encryption-key-v1, and stretched to 256 bits with HKDF.
+	Name           string
+	CurrentVersion int
+}
+
+const DefaultTOTPEncryptionKeyName = "totp-encryption-key"
+
+// ParseEncryptionKeys reads keys from the same configuration as ParsePepper, with defaultName when no name is given.
+func ParseEncryptionKeys(config string, defaultName string) (EncryptionKeys, error) {
+	provider, name, version, err := parseVersionedSecretConfig(config, defaultName)
+	if err != nil {
+		return EncryptionKeys{}, err
+	}
+	keys := EncryptionKeys{Provider: provider, Name: name, CurrentVersion: version}
+
+	if _, err := keys.aead(keys.CurrentVersion); err != nil {
+		return EncryptionKeys{}, err
+	}
+	return keys, nil
+}
+
+func (k *EncryptionKeys) aead(version int) (cipher.AEAD, error) {
+	secret, err := versionedSecret(k.Provider, k.Name, version)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(k.Name)), key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns v<version>$<base64 nonce and ciphertext>. additionalData binds the value to its row, so a
+// sealed value copied to another row does not open.
+func (k *EncryptionKeys) seal(plaintext []byte, additionalData []byte) (string, error) {
+	aead, err := k.aead(k.CurrentVersion)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return "v" + strconv.Itoa(k.CurrentVersion) + "$" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *EncryptionKeys) open(sealed string, additionalData []byte) ([]byte, error) {
+	versionString, encoded, found := strings.Cut(strings.TrimPrefix(sealed, "v"), "$")
+	version, err := strconv.Atoi(versionString)
+	if !found || !strings.HasPrefix(sealed, "v") || err != nil || version <= 0 {
+		return nil, errors.New("invalid sealed value")
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := k.aead(version)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("invalid sealed value")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+}
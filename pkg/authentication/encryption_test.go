@@ -0,0 +1,41 @@
+package authentication
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptionKeys(t *testing.T) {
+	provider := mapSecretProvider{
+		"totp-encryption-key-v1": "first-key-0123456789",
+		"totp-encryption-key-v2": "second-key-0123456789",
+	}
+	first := &EncryptionKeys{Provider: provider, Name: DefaultTOTPEncryptionKeyName, CurrentVersion: 1}
+	second := &EncryptionKeys{Provider: provider, Name: DefaultTOTPEncryptionKeyName, CurrentVersion: 2}
+
+	sealed, err := first.seal([]byte("secret"), []byte("row"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "v1$") || strings.Contains(sealed, "secret") {
+		t.Fatalf("sealed = %s", sealed)
+	}
+
+	opened, err := second.open(sealed, []byte("row"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != "secret" {
+		t.Fatalf("opened = %q", opened)
+	}
+
+	if _, err := second.open(sealed, []byte("other row")); err == nil {
+		t.Fatal("value opened for another row")
+	}
+	if _, err := second.open("v1$"+strings.Repeat("A", 40), []byte("row")); err == nil {
+		t.Fatal("tampered value opened")
+	}
+	if _, err := second.open("plaintext", []byte("row")); err == nil {
+		t.Fatal("unsealed value opened")
+	}
+}
@@ -0,0 +1,118 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// NotificationRegistered welcomes a new entity, which gets no tokens from RegisterPassword in enumeration
+	// protection mode and has to sign in.
+	NotificationRegistered = "registered"
+	// NotificationAlreadyRegistered tells the owner of an email that someone tried to register it again.
+	NotificationAlreadyRegistered = "already_registered"
+	// NotificationPasswordReset carries the token ForgotPassword no longer returns in enumeration protection mode.
+	NotificationPasswordReset = "password_reset"
+	// NotificationAccountLocked tells the owner that failed logins locked their account until LockedUntil, which
+	// LoginPassword no longer answers with in enumeration protection mode.
+	NotificationAccountLocked = "account_locked"
+)
+
+type Notification struct {
+	Type         string    `json:"type"`
+	Entity       uuid.UUID `json:"entity"`
+	PrimaryEmail string    `json:"primary_email"`
+
+	PasswordResetToken          string `json:"password_reset_token,omitempty"`
+	PasswordResetTokenExpiresAt int64  `json:"password_reset_token_expires_at,omitempty"`
+
+	LockedUntil int64 `json:"locked_until,omitempty"`
+}
+
+// Notifier delivers what enumeration protection keeps out of responses to the owner of the email, e.g. by
+// mail. Notify runs in the background so that it does not show in response times, and its errors do not
+// reach the caller: implementations report or retry failed deliveries themselves.
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+type NotifierFunc func(ctx context.Context, notification Notification) error
+
+func (f NotifierFunc) Notify(ctx context.Context, notification Notification) error {
+	return f(ctx, notification)
+}
+
+// WebhookNotifier posts every notification as JSON to a URL, e.g. the function that sends the emails.
+type WebhookNotifier struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewWebhookNotifier(endpoint string, httpClient *http.Client) *WebhookNotifier {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &WebhookNotifier{endpoint: endpoint, httpClient: httpClient}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := n.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return fmt.Errorf("notification endpoint returned %s", httpResp.Status)
+	}
+	return nil
+}
+
+func (dal *DALPostgres) enumerationProtection() bool {
+	return dal.notifier != nil
+}
+
+// notificationTimeout bounds a notification, which outlives the request that caused it.
+const notificationTimeout = 30 * time.Second
+
+// notify hands notification to the notifier in the background. Close waits for pending notifications.
+func (dal *DALPostgres) notify(ctx context.Context, notification Notification) {
+	dal.notifying.Add(1)
+	go func() {
+		defer dal.notifying.Done()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notificationTimeout)
+		defer cancel()
+		_ = dal.notifier.Notify(ctx, notification)
+	}()
+}
+
+// dummyPasswordHash is compared against when an identifier is unknown, so that LoginPassword takes as long
+// as for a wrong password. It is created on first use with the current hasher.
+func (dal *DALPostgres) dummyPasswordHash() string {
+	dal.dummyHashOnce.Do(func() {
+		password, err := GetRandomAlphanumericString(32)
+		if err != nil {
+			return
+		}
+		dal.dummyHash, _ = dal.hashPassword(password)
+	})
+	return dal.dummyHash
+}
@@ -0,0 +1,62 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan Notification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Error(err)
+		}
+		received <- notification
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	want := Notification{Type: NotificationAlreadyRegistered, Entity: uuid.New(), PrimaryEmail: "1234@email.com"}
+	if err := NewWebhookNotifier(server.URL, nil).Notify(context.Background(), want); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != want {
+		t.Fatalf("notification = %+v, want %+v", got, want)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	if err := NewWebhookNotifier(failing.URL, nil).Notify(context.Background(), want); err == nil {
+		t.Fatal("failed delivery not reported")
+	}
+}
+
+func TestNotifyRunsInBackground(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan error, 1)
+	dal := &DALPostgres{notifier: NotifierFunc(func(ctx context.Context, notification Notification) error {
+		<-release
+		delivered <- ctx.Err()
+		return nil
+	})}
+
+	// The request's context ends with its response, which must not cancel the notification.
+	ctx, cancel := context.WithCancel(context.Background())
+	dal.notify(ctx, Notification{Type: NotificationPasswordReset})
+	cancel()
+
+	close(release)
+	dal.notifying.Wait()
+	if err := <-delivered; err != nil {
+		t.Fatalf("notification context ended with the request: %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+package authentication
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+type SigningKeyState string
+
+const (
+	SigningKeyStateActive    SigningKeyState = "active"
+	SigningKeyStateVerifying SigningKeyState = "verifying"
+	SigningKeyStateRetired   SigningKeyState = "retired"
+)
+
+// Unknown kids trigger a reload at most this often, so garbage tokens can't hammer the database.
+const keyRingMinReloadInterval = 10 * time.Second
+
+type KeyRotationPolicy struct {
+	// How long a key signs new tokens before it is rotated out. Zero disables scheduled rotation.
+	RotationInterval time.Duration
+	// How long a rotated-out key keeps verifying. Must cover the longest token lifetime.
+	VerificationPeriod time.Duration
+	// How often keys are reloaded to pick up rotations made by other instances.
+	RefreshInterval time.Duration
+	// RS256, ES256, ES384 or EdDSA.
+	Algorithm string
+}
+
+var DefaultKeyRotationPolicy = KeyRotationPolicy{
+	RotationInterval:   time.Hour * 24 * 30,
+	VerificationPeriod: time.Hour * 24 * 31,
+	RefreshInterval:    time.Minute * 5,
+	Algorithm:          jwt.SigningMethodES256.Alg(),
+}
+
+const DefaultSigningKeyEncryptionKeyName = "signing-key-encryption-key"
+
+// CoveringLifetimes returns the policy with VerificationPeriod extended to the longest token lifetime of
+// lifetimes, so rotated-out keys verify every token they signed until it expires.
+func (p KeyRotationPolicy) CoveringLifetimes(lifetimes TokenLifetimePolicy) KeyRotationPolicy {
+	p.VerificationPeriod = max(p.VerificationPeriod, lifetimes.LongestTTL())
+	return p
+}
+
+// KeyRing is a Signer backed by the signing_keys table. It signs with the single active key and
+// verifies with the active and verifying-only keys, rotating on schedule or on demand.
+// It holds its own connection because signing happens while the DAL connection is inside a transaction.
+// The active private key is stored sealed with encryptionKeys; rotated-out keys keep only their public key.
+type KeyRing struct {
+	db             *pgx.Conn
+	dbMu           sync.Mutex
+	policy         KeyRotationPolicy
+	encryptionKeys EncryptionKeys
+
+	mu       sync.RWMutex
+	active   *AsymmetricSigner
+	rotateAt *time.Time
+	keys     map[string]*VerificationKey
+	loadedAt time.Time
+}
+
+func NewKeyRing(ctx context.Context, connString string, policy KeyRotationPolicy, encryptionKeys EncryptionKeys) (*KeyRing, error) {
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &KeyRing{
+		db:             conn,
+		policy:         policy,
+		encryptionKeys: encryptionKeys,
+		keys:           make(map[string]*VerificationKey),
+	}
+
+	if err := ring.rotate(ctx, false); err != nil {
+		ring.Close()
+		return nil, err
+	}
+	if err := ring.Load(ctx); err != nil {
+		ring.Close()
+		return nil, err
+	}
+	return ring, nil
+}
+
+func (r *KeyRing) Close() {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	err := r.db.Close(context.Background())
+	if err != nil {
+		return
+	}
+}
+
+func (r *KeyRing) Load(ctx context.Context) error {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	query := `SELECT kid, private_key, public_key, state, rotate_at FROM signing_keys WHERE state IN ('active', 'verifying');`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var active *AsymmetricSigner
+	var rotateAt *time.Time
+	keys := make(map[string]*VerificationKey)
+	for rows.Next() {
+		var kid, publicKeyPEM, state string
+		var privateKey *string
+		var rotateAtEpoch *int64
+		if err := rows.Scan(&kid, &privateKey, &publicKeyPEM, &state, &rotateAtEpoch); err != nil {
+			return err
+		}
+
+		if SigningKeyState(state) == SigningKeyStateActive {
+			if privateKey == nil {
+				return fmt.Errorf("active signing key %s has no private key", kid)
+			}
+			privateKeyPEM, err := r.openPrivateKey(kid, *privateKey)
+			if err != nil {
+				return err
+			}
+			active, err = NewSignerFromPEM(kid, privateKeyPEM)
+			if err != nil {
+				return err
+			}
+			if rotateAtEpoch != nil {
+				t := time.Unix(*rotateAtEpoch, 0).UTC()
+				rotateAt = &t
+			}
+			keys[kid] = active.VerificationKeys()[0]
+			continue
+		}
+
+		publicKey, err := ParsePublicKeyPEM([]byte(publicKeyPEM))
+		if err != nil {
+			return err
+		}
+		method, err := signingMethodForKey(publicKey)
+		if err != nil {
+			return err
+		}
+		keys[kid] = &VerificationKey{KeyID: kid, Method: method, PublicKey: publicKey}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if active == nil {
+		return fmt.Errorf("no active signing key")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active = active
+	r.rotateAt = rotateAt
+	r.keys = keys
+	r.loadedAt = time.Now()
+	return nil
+}
+
+// Rotate immediately replaces the active key. The previous key keeps verifying for the policy's verification period.
+func (r *KeyRing) Rotate(ctx context.Context) (string, error) {
+	if err := r.rotate(ctx, true); err != nil {
+		return "", err
+	}
+	if err := r.Load(ctx); err != nil {
+		return "", err
+	}
+	return r.KeyID(), nil
+}
+
+// rotate retires expired verifying keys and replaces the active key when forced, missing or due.
+// The table lock makes concurrent instances agree on a single rotation.
+func (r *KeyRing) rotate(ctx context.Context, force bool) error {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query1 := `LOCK TABLE signing_keys IN SHARE ROW EXCLUSIVE MODE;`
+	if _, err = tx.Exec(ctx, query1); err != nil {
+		return err
+	}
+
+	query2 := `UPDATE signing_keys SET state = 'retired', retired_at = current_epoch() WHERE state = 'verifying' AND verify_until <= current_epoch();`
+	if _, err = tx.Exec(ctx, query2); err != nil {
+		return err
+	}
+
+	var rotateAt *int64
+	var isPlaintext bool
+	query3 := `SELECT rotate_at, private_key LIKE '-----BEGIN %' FROM signing_keys WHERE state = 'active';`
+	err = tx.QueryRow(ctx, query3).Scan(&rotateAt, &isPlaintext)
+	hasActive := true
+	if errors.Is(err, pgx.ErrNoRows) {
+		hasActive = false
+	} else if err != nil {
+		return err
+	}
+
+	// Keys stored before private keys were sealed are replaced straight away.
+	isDue := isPlaintext || rotateAt != nil && *rotateAt <= time.Now().UTC().Unix()
+	if hasActive && !force && !isDue {
+		return tx.Commit(ctx)
+	}
+
+	privateKey, err := generateSigningKey(r.policy.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	privateKeyPEM, publicKeyPEM, err := encodeSigningKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	kid, err := GetRandomAlphanumericString(16)
+	if err != nil {
+		return err
+	}
+
+	sealedPrivateKey, err := r.encryptionKeys.seal([]byte(privateKeyPEM), []byte(kid))
+	if err != nil {
+		return err
+	}
+
+	// Verifying only needs the public key, so the private key is dropped as soon as the key stops signing.
+	query4 := `UPDATE signing_keys SET state = 'verifying', private_key = NULL, rotate_at = NULL, verify_until = current_epoch() + $1 WHERE state = 'active';`
+	if _, err = tx.Exec(ctx, query4, int64(r.policy.VerificationPeriod.Seconds())); err != nil {
+		return err
+	}
+
+	var nextRotation *int64
+	if r.policy.RotationInterval > 0 {
+		next := time.Now().UTC().Add(r.policy.RotationInterval).Unix()
+		nextRotation = &next
+	}
+
+	query5 := `INSERT INTO signing_keys (kid, algorithm, private_key, public_key, state, rotate_at) VALUES ($1, $2, $3, $4, 'active', $5);`
+	if _, err = tx.Exec(ctx, query5, kid, r.policy.Algorithm, sealedPrivateKey, publicKeyPEM, nextRotation); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// openPrivateKey unseals a private key, which is bound to its kid. Plaintext PEM from before private keys
+// were sealed is still read, until the next rotation replaces it.
+func (r *KeyRing) openPrivateKey(kid string, privateKey string) ([]byte, error) {
+	if strings.HasPrefix(privateKey, "-----BEGIN ") {
+		return []byte(privateKey), nil
+	}
+	return r.encryptionKeys.open(privateKey, []byte(kid))
+}
+
+// refresh reloads stale keys and performs any scheduled rotation. A ring that already holds an
+// active key keeps serving from memory if the database is unavailable.
+func (r *KeyRing) refresh(ctx context.Context) error {
+	r.mu.RLock()
+	stale := time.Since(r.loadedAt) >= r.policy.RefreshInterval
+	due := r.rotateAt != nil && !time.Now().Before(*r.rotateAt)
+	hasActive := r.active != nil
+	r.mu.RUnlock()
+
+	if !stale && !due {
+		return nil
+	}
+
+	err := r.rotate(ctx, false)
+	if err == nil {
+		err = r.Load(ctx)
+	}
+	if err != nil && hasActive {
+		return nil
+	}
+	return err
+}
+
+func (r *KeyRing) KeyID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active.KeyID()
+}
+
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if err := r.refresh(context.Background()); err != nil {
+		return "", err
+	}
+
+	r.mu.RLock()
+	active := r.active
+	r.mu.RUnlock()
+	return active.Sign(claims)
+}
+
+func (r *KeyRing) VerificationKey(kid string) (*VerificationKey, error) {
+	if err := r.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	canReload := time.Since(r.loadedAt) >= keyRingMinReloadInterval
+	r.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// The key may have been rotated in by another instance since the last load.
+	if canReload {
+		if err := r.Load(context.Background()); err != nil {
+			return nil, err
+		}
+		r.mu.RLock()
+		key, ok = r.keys[kid]
+		r.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+func (r *KeyRing) VerificationKeys() []*VerificationKey {
+	_ = r.refresh(context.Background())
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*VerificationKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// CacheMaxAge is how long a published key set stays accurate: until the next scheduled rotation,
+// bounded by DefaultJWKSCacheMaxAge.
+func (r *KeyRing) CacheMaxAge() time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	maxAge := DefaultJWKSCacheMaxAge
+	if r.rotateAt != nil {
+		untilRotation := time.Until(*r.rotateAt)
+		if untilRotation < 0 {
+			untilRotation = 0
+		}
+		if untilRotation < maxAge {
+			maxAge = untilRotation
+		}
+	}
+	return maxAge.Truncate(time.Second)
+}
+
+func generateSigningKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodES384.Alg():
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+func encodeSigningKey(privateKey crypto.Signer) (string, string, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return "", "", err
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return string(privatePEM), string(publicPEM), nil
+}
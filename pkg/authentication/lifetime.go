@@ -0,0 +1,196 @@
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type ClientType string
+
+const (
+	ClientTypeWeb    ClientType = "web"
+	ClientTypeMobile ClientType = "mobile"
+	ClientTypeCLI    ClientType = "cli"
+)
+
+func (c ClientType) IsValid() bool {
+	switch c {
+	case "", ClientTypeWeb, ClientTypeMobile, ClientTypeCLI:
+		return true
+	default:
+		return false
+	}
+}
+
+type TokenLifetime struct {
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// TokenLifetimePolicy picks token lifetimes by client type first, then by the audience tokens are requested
+// for, then Default.
+// Zero durations in an override fall back to the Default ones.
+type TokenLifetimePolicy struct {
+	Default     TokenLifetime
+	ClientTypes map[ClientType]TokenLifetime
+	Audiences   map[string]TokenLifetime
+}
+
+var DefaultTokenLifetimePolicy = TokenLifetimePolicy{
+	Default: TokenLifetime{
+		AccessTokenTTL:  time.Minute * 15,
+		RefreshTokenTTL: time.Hour * 24 * 30,
+	},
+}
+
+func (p TokenLifetimePolicy) Lifetime(clientType ClientType, audiences []string) TokenLifetime {
+	if lifetime, ok := p.ClientTypes[clientType]; ok && clientType != "" {
+		return p.withDefaults(lifetime)
+	}
+	for _, audience := range audiences {
+		if lifetime, ok := p.Audiences[audience]; ok {
+			return p.withDefaults(lifetime)
+		}
+	}
+	return p.Default
+}
+
+func (p TokenLifetimePolicy) withDefaults(lifetime TokenLifetime) TokenLifetime {
+	if lifetime.AccessTokenTTL == 0 {
+		lifetime.AccessTokenTTL = p.Default.AccessTokenTTL
+	}
+	if lifetime.RefreshTokenTTL == 0 {
+		lifetime.RefreshTokenTTL = p.Default.RefreshTokenTTL
+	}
+	return lifetime
+}
+
+type tokenLifetimeConfig struct {
+	AccessTokenTTL  string `json:"access_token_ttl,omitempty"`
+	RefreshTokenTTL string `json:"refresh_token_ttl,omitempty"`
+}
+
+// ParseTokenLifetimePolicy reads a policy from configuration, for example:
+//
+//	{"default": {"access_token_ttl": "15m", "refresh_token_ttl": "720h"},
+//	 "client_types": {"cli": {"refresh_token_ttl": "2160h"}},
+//	 "audiences": {"https://admin.test.com": {"access_token_ttl": "5m"}}}
+//
+// Anything left out keeps the value from DefaultTokenLifetimePolicy.
+func ParseTokenLifetimePolicy(config string) (TokenLifetimePolicy, error) {
+	var raw struct {
+		Default     tokenLifetimeConfig                `json:"default"`
+		ClientTypes map[ClientType]tokenLifetimeConfig `json:"client_types"`
+		Audiences   map[string]tokenLifetimeConfig     `json:"audiences"`
+	}
+	if err := json.Unmarshal([]byte(config), &raw); err != nil {
+		return TokenLifetimePolicy{}, err
+	}
+
+	policy := TokenLifetimePolicy{Default: DefaultTokenLifetimePolicy.Default}
+
+	lifetime, err := raw.Default.parse()
+	if err != nil {
+		return TokenLifetimePolicy{}, err
+	}
+	policy.Default = policy.withDefaults(lifetime)
+
+	if len(raw.ClientTypes) > 0 {
+		policy.ClientTypes = make(map[ClientType]TokenLifetime, len(raw.ClientTypes))
+		for clientType, config := range raw.ClientTypes {
+			if clientType == "" || !clientType.IsValid() {
+				return TokenLifetimePolicy{}, fmt.Errorf("unsupported client type: %q", clientType)
+			}
+			if policy.ClientTypes[clientType], err = config.parse(); err != nil {
+				return TokenLifetimePolicy{}, err
+			}
+		}
+	}
+
+	if len(raw.Audiences) > 0 {
+		policy.Audiences = make(map[string]TokenLifetime, len(raw.Audiences))
+		for audience, config := range raw.Audiences {
+			if policy.Audiences[audience], err = config.parse(); err != nil {
+				return TokenLifetimePolicy{}, err
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+func (c tokenLifetimeConfig) parse() (TokenLifetime, error) {
+	var lifetime TokenLifetime
+	var err error
+	if c.AccessTokenTTL != "" {
+		if lifetime.AccessTokenTTL, err = parseTTL(c.AccessTokenTTL); err != nil {
+			return TokenLifetime{}, err
+		}
+	}
+	if c.RefreshTokenTTL != "" {
+		if lifetime.RefreshTokenTTL, err = parseTTL(c.RefreshTokenTTL); err != nil {
+			return TokenLifetime{}, err
+		}
+	}
+	return lifetime, nil
+}
+
+func parseTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("token lifetime must be positive: %s", value)
+	}
+	return ttl, nil
+}
+
+// LongestTTL is the longest lifetime any token can be issued with, which keys must keep verifying for.
+func (p TokenLifetimePolicy) LongestTTL() time.Duration {
+	longest := max(p.Default.AccessTokenTTL, p.Default.RefreshTokenTTL)
+	for _, lifetime := range p.ClientTypes {
+		lifetime = p.withDefaults(lifetime)
+		longest = max(longest, lifetime.AccessTokenTTL, lifetime.RefreshTokenTTL)
+	}
+	for _, lifetime := range p.Audiences {
+		lifetime = p.withDefaults(lifetime)
+		longest = max(longest, lifetime.AccessTokenTTL, lifetime.RefreshTokenTTL)
+	}
+	return longest
+}
+
+const reasonUnsupportedAudience = "Unsupported audience"
+
+// issuedAudience returns the aud claim for tokens requested for audience, or false if the DAL does not
+// issue tokens for it. Without a requested audience tokens carry all of the DAL's audiences. A requested
+// audience must be one of the DAL's audiences, or when it has none, one the lifetime policy names, so
+// callers can't mint tokens for services they pick themselves.
+func (dal *DALPostgres) issuedAudience(audience string) ([]string, bool) {
+	if audience == "" {
+		return dal.tokenAudience, true
+	}
+
+	known := slices.Contains(dal.tokenAudience, audience)
+	if len(dal.tokenAudience) == 0 {
+		_, known = dal.lifetimePolicy.Audiences[audience]
+	}
+	if !known {
+		return nil, false
+	}
+	return []string{audience}, true
+}
+
+// storedAudience is the requested audience as kept with a session, so refreshes issue for the same one.
+func storedAudience(audience string) *string {
+	if audience == "" {
+		return nil
+	}
+	return &audience
+}
+
+func (dal *DALPostgres) tokenLifetime(clientType ClientType, audience []string) TokenLifetime {
+	return dal.lifetimePolicy.Lifetime(clientType, audience)
+}
@@ -0,0 +1,74 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTokenLifetimePolicy(t *testing.T) {
+	policy, err := ParseTokenLifetimePolicy(`{
+		"default": {"access_token_ttl": "10m"},
+		"client_types": {"cli": {"refresh_token_ttl": "2160h"}, "mobile": {"access_token_ttl": "1h", "refresh_token_ttl": "8760h"}},
+		"audiences": {"https://admin.test.com": {"access_token_ttl": "5m"}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		clientType ClientType
+		audiences  []string
+		want       TokenLifetime
+	}{
+		{"", nil, TokenLifetime{10 * time.Minute, 30 * 24 * time.Hour}},
+		{ClientTypeWeb, nil, TokenLifetime{10 * time.Minute, 30 * 24 * time.Hour}},
+		{ClientTypeCLI, nil, TokenLifetime{10 * time.Minute, 90 * 24 * time.Hour}},
+		{ClientTypeMobile, []string{"https://admin.test.com"}, TokenLifetime{time.Hour, 365 * 24 * time.Hour}},
+		{ClientTypeWeb, []string{"https://admin.test.com"}, TokenLifetime{5 * time.Minute, 30 * 24 * time.Hour}},
+	}
+	for _, c := range cases {
+		if got := policy.Lifetime(c.clientType, c.audiences); got != c.want {
+			t.Errorf("Lifetime(%q, %v) = %+v, want %+v", c.clientType, c.audiences, got, c.want)
+		}
+	}
+
+	if longest := policy.LongestTTL(); longest != 365*24*time.Hour {
+		t.Fatalf("LongestTTL() = %s", longest)
+	}
+	if period := DefaultKeyRotationPolicy.CoveringLifetimes(policy).VerificationPeriod; period != 365*24*time.Hour {
+		t.Fatalf("verification period %s does not cover the longest lifetime", period)
+	}
+	if period := DefaultKeyRotationPolicy.CoveringLifetimes(DefaultTokenLifetimePolicy).VerificationPeriod; period != DefaultKeyRotationPolicy.VerificationPeriod {
+		t.Fatalf("verification period %s shortened", period)
+	}
+
+	if _, err := ParseTokenLifetimePolicy(`{"client_types": {"tv": {"access_token_ttl": "1h"}}}`); err == nil {
+		t.Fatal("unknown client type accepted")
+	}
+	if _, err := ParseTokenLifetimePolicy(`{"default": {"access_token_ttl": "-1m"}}`); err == nil {
+		t.Fatal("negative lifetime accepted")
+	}
+}
+
+func TestIssuedAudience(t *testing.T) {
+	dal := &DALPostgres{tokenAudience: []string{"https://api.test.com", "https://admin.test.com"}}
+
+	if audience, ok := dal.issuedAudience(""); !ok || len(audience) != 2 {
+		t.Fatalf("issuedAudience(\"\") = %v, %v", audience, ok)
+	}
+	if audience, ok := dal.issuedAudience("https://admin.test.com"); !ok || len(audience) != 1 || audience[0] != "https://admin.test.com" {
+		t.Fatalf("issuedAudience(admin) = %v, %v", audience, ok)
+	}
+	if _, ok := dal.issuedAudience("https://other.test.com"); ok {
+		t.Fatal("audience outside the DAL's audiences accepted")
+	}
+
+	// Without audiences of its own the DAL only issues for audiences the lifetime policy names.
+	dal = &DALPostgres{lifetimePolicy: TokenLifetimePolicy{Audiences: map[string]TokenLifetime{"https://admin.test.com": {}}}}
+	if audience, ok := dal.issuedAudience("https://admin.test.com"); !ok || len(audience) != 1 {
+		t.Fatalf("issuedAudience(admin) = %v, %v", audience, ok)
+	}
+	if _, ok := dal.issuedAudience("https://other.test.com"); ok {
+		t.Fatal("audience unknown to the lifetime policy accepted")
+	}
+}
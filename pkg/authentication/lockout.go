@@ -0,0 +1,278 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LockoutPolicy locks a login method, or the whole entity, after too many failed logins. Each failure past
+// a threshold doubles the lock, so guessing slows down exponentially. Locks expire on their own.
+type LockoutPolicy struct {
+	// Failed logins with one login method before it is locked. Zero disables the per method lock.
+	MaxFailedAttempts int
+	// Failed logins across all of an entity's login methods before the entity is locked. Zero disables it.
+	MaxEntityFailedAttempts int
+
+	// The first lock lasts LockDuration and each further failure doubles it up to MaxLockDuration.
+	// A zero MaxLockDuration keeps every lock at LockDuration.
+	LockDuration    time.Duration
+	MaxLockDuration time.Duration
+	// Failures are forgotten once the last one is older than FailureWindow. Zero keeps them until a successful login.
+	FailureWindow time.Duration
+}
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxFailedAttempts:       5,
+	MaxEntityFailedAttempts: 10,
+	LockDuration:            time.Minute,
+	MaxLockDuration:         time.Hour,
+	FailureWindow:           24 * time.Hour,
+}
+
+const (
+	ErrorCodeInvalidCredentials = "invalid_credentials"
+	ErrorCodeAccountLocked      = "account_locked"
+)
+
+const reasonAccountLocked = "Account locked"
+
+// Login method types are also the names of the tables holding the methods, which all track failed logins.
+const (
+	loginMethodPassword = "entity_login_method_password"
+	loginMethodTOTP     = "entity_login_method_totp"
+)
+
+var lockableLoginMethods = []string{loginMethodPassword, loginMethodTOTP}
+
+// ParseLockoutPolicy reads a policy from configuration, for example:
+//
+//	{"max_failed_attempts": 5, "max_entity_failed_attempts": 10,
+//	 "lock_duration": "1m", "max_lock_duration": "1h", "failure_window": "24h"}
+//
+// Anything left out keeps the value from DefaultLockoutPolicy.
+func ParseLockoutPolicy(config string) (LockoutPolicy, error) {
+	var raw struct {
+		MaxFailedAttempts       *int   `json:"max_failed_attempts"`
+		MaxEntityFailedAttempts *int   `json:"max_entity_failed_attempts"`
+		LockDuration            string `json:"lock_duration"`
+		MaxLockDuration         string `json:"max_lock_duration"`
+		FailureWindow           string `json:"failure_window"`
+	}
+	if err := json.Unmarshal([]byte(config), &raw); err != nil {
+		return LockoutPolicy{}, err
+	}
+
+	policy := DefaultLockoutPolicy
+	if raw.MaxFailedAttempts != nil {
+		policy.MaxFailedAttempts = *raw.MaxFailedAttempts
+	}
+	if raw.MaxEntityFailedAttempts != nil {
+		policy.MaxEntityFailedAttempts = *raw.MaxEntityFailedAttempts
+	}
+
+	var err error
+	if raw.LockDuration != "" {
+		if policy.LockDuration, err = time.ParseDuration(raw.LockDuration); err != nil {
+			return LockoutPolicy{}, err
+		}
+	}
+	if raw.MaxLockDuration != "" {
+		if policy.MaxLockDuration, err = time.ParseDuration(raw.MaxLockDuration); err != nil {
+			return LockoutPolicy{}, err
+		}
+	}
+	if raw.FailureWindow != "" {
+		if policy.FailureWindow, err = time.ParseDuration(raw.FailureWindow); err != nil {
+			return LockoutPolicy{}, err
+		}
+	}
+
+	if policy.LockDuration <= 0 {
+		return LockoutPolicy{}, fmt.Errorf("lock duration must be positive: %s", policy.LockDuration)
+	}
+	if policy.MaxLockDuration < policy.LockDuration {
+		return LockoutPolicy{}, fmt.Errorf("max lock duration must not be shorter than the lock duration: %s", policy.MaxLockDuration)
+	}
+	if policy.FailureWindow < 0 {
+		return LockoutPolicy{}, fmt.Errorf("failure window must not be negative: %s", policy.FailureWindow)
+	}
+	return policy, nil
+}
+
+// LockDurationAfter returns how long to lock after failedAttempts failures against threshold, or zero
+// while below it.
+func (p LockoutPolicy) LockDurationAfter(failedAttempts int, threshold int) time.Duration {
+	if threshold <= 0 || failedAttempts < threshold {
+		return 0
+	}
+
+	duration := p.LockDuration
+	for i := threshold; i < failedAttempts && duration < p.MaxLockDuration; i++ {
+		duration *= 2
+	}
+	if p.MaxLockDuration > 0 && duration > p.MaxLockDuration {
+		duration = p.MaxLockDuration
+	}
+	return duration
+}
+
+// loginLockedUntil returns when the lock on the login method or its entity ends, or zero if neither is locked.
+func (dal *DALPostgres) loginLockedUntil(ctx context.Context, db dbtx, entityID uuid.UUID, methodType string, methodID uuid.UUID) (int64, error) {
+	if dal.lockoutPolicy == nil {
+		return 0, nil
+	}
+
+	query1 := fmt.Sprintf(`SELECT GREATEST(COALESCE(m.locked_until, 0), COALESCE(e.locked_until, 0)), current_epoch()
+				FROM entities e, %s m WHERE e.id = $1 AND m.id = $2;`, methodType)
+
+	var lockedUntil, now int64
+	err := db.QueryRow(ctx, query1, entityID, methodID).Scan(&lockedUntil, &now)
+	if err != nil {
+		return 0, err
+	}
+	if lockedUntil <= now {
+		return 0, nil
+	}
+	return lockedUntil, nil
+}
+
+// recordFailedLogin counts a failed login against the login method and its entity, locks whichever reached
+// its threshold, and returns when the resulting lock ends or zero if nothing was locked.
+func (dal *DALPostgres) recordFailedLogin(ctx context.Context, entityID uuid.UUID, methodType string, methodID uuid.UUID, client clientContext) (int64, error) {
+	if dal.lockoutPolicy == nil {
+		return 0, nil
+	}
+	policy := dal.lockoutPolicy
+	failureWindow := int64(policy.FailureWindow / time.Second)
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Failures older than the window start the count over.
+	query1 := fmt.Sprintf(`UPDATE %s SET
+				failed_attempts = CASE WHEN $2 > 0 AND last_failed_at <= current_epoch() - $2 THEN 1 ELSE failed_attempts + 1 END,
+				last_failed_at = current_epoch()
+				WHERE id = $1 RETURNING failed_attempts;`, methodType)
+	var methodFailedAttempts int
+	err = tx.QueryRow(ctx, query1, methodID, failureWindow).Scan(&methodFailedAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	query2 := `UPDATE entities SET
+				failed_login_attempts = CASE WHEN $2 > 0 AND last_failed_login_at <= current_epoch() - $2 THEN 1 ELSE failed_login_attempts + 1 END,
+				last_failed_login_at = current_epoch()
+				WHERE id = $1 RETURNING failed_login_attempts;`
+	var entityFailedAttempts int
+	err = tx.QueryRow(ctx, query2, entityID, failureWindow).Scan(&entityFailedAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	var lockedUntil int64
+	if duration := policy.LockDurationAfter(methodFailedAttempts, policy.MaxFailedAttempts); duration > 0 {
+		query3 := fmt.Sprintf(`UPDATE %s SET locked_until = current_epoch() + $2 WHERE id = $1 RETURNING locked_until;`, methodType)
+		var methodLockedUntil int64
+		err = tx.QueryRow(ctx, query3, methodID, int64(duration/time.Second)).Scan(&methodLockedUntil)
+		if err != nil {
+			return 0, err
+		}
+		lockedUntil = max(lockedUntil, methodLockedUntil)
+
+		details := fmt.Sprintf("login method %s locked for %s after %d failed attempts", methodID, duration, methodFailedAttempts)
+		err = dal.recordSecurityEvent(ctx, tx, entityID, SecurityEventLoginLocked, details, client)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if duration := policy.LockDurationAfter(entityFailedAttempts, policy.MaxEntityFailedAttempts); duration > 0 {
+		query4 := `UPDATE entities SET locked_until = current_epoch() + $2 WHERE id = $1 RETURNING locked_until;`
+		var entityLockedUntil int64
+		err = tx.QueryRow(ctx, query4, entityID, int64(duration/time.Second)).Scan(&entityLockedUntil)
+		if err != nil {
+			return 0, err
+		}
+		lockedUntil = max(lockedUntil, entityLockedUntil)
+
+		details := fmt.Sprintf("entity locked for %s after %d failed attempts", duration, entityFailedAttempts)
+		err = dal.recordSecurityEvent(ctx, tx, entityID, SecurityEventLoginLocked, details, client)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return lockedUntil, nil
+}
+
+// resetFailedLogins clears the failure counts after a successful login.
+func (dal *DALPostgres) resetFailedLogins(ctx context.Context, db dbtx, entityID uuid.UUID, methodType string, methodID uuid.UUID) error {
+	if dal.lockoutPolicy == nil {
+		return nil
+	}
+
+	query1 := fmt.Sprintf(`UPDATE %s SET failed_attempts = 0, last_failed_at = NULL, locked_until = NULL
+				WHERE id = $1 AND (failed_attempts <> 0 OR locked_until IS NOT NULL);`, methodType)
+	_, err := db.Exec(ctx, query1, methodID)
+	if err != nil {
+		return err
+	}
+
+	query2 := `UPDATE entities SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+				WHERE id = $1 AND (failed_login_attempts <> 0 OR locked_until IS NOT NULL);`
+	_, err = db.Exec(ctx, query2, entityID)
+	return err
+}
+
+// UnlockEntity lifts the locks on an entity and all of its login methods and clears their failure counts.
+func (dal *DALPostgres) UnlockEntity(ctx context.Context, req *UnlockEntityRequest) (*UnlockEntityResponse, error) {
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &UnlockEntityResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query1 := `UPDATE entities SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+				WHERE id = $1 AND active = true;`
+	tag, err := tx.Exec(ctx, query1, req.Entity)
+	if err != nil {
+		return &UnlockEntityResponse{Valid: false, Error: err.Error()}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return &UnlockEntityResponse{Valid: false, Error: "Not found"}, nil
+	}
+
+	for _, methodType := range lockableLoginMethods {
+		query2 := fmt.Sprintf(`UPDATE %s SET failed_attempts = 0, last_failed_at = NULL, locked_until = NULL
+					WHERE id IN (SELECT method_id FROM entity_login_methods WHERE entity_id = $1 AND method_type = $2);`, methodType)
+		_, err = tx.Exec(ctx, query2, req.Entity, methodType)
+		if err != nil {
+			return &UnlockEntityResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+	err = dal.recordSecurityEvent(ctx, tx, req.Entity, SecurityEventLoginUnlocked, req.Reason, client)
+	if err != nil {
+		return &UnlockEntityResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &UnlockEntityResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &UnlockEntityResponse{
+		Entity: req.Entity,
+		Valid:  true,
+		Error:  "",
+	}, nil
+}
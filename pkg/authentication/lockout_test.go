@@ -0,0 +1,54 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockDurationAfter(t *testing.T) {
+	policy := LockoutPolicy{LockDuration: time.Minute, MaxLockDuration: 10 * time.Minute}
+
+	cases := []struct {
+		failedAttempts int
+		threshold      int
+		want           time.Duration
+	}{
+		{4, 5, 0},
+		{5, 5, time.Minute},
+		{6, 5, 2 * time.Minute},
+		{8, 5, 8 * time.Minute},
+		{9, 5, 10 * time.Minute},
+		{1000, 5, 10 * time.Minute},
+		{1000, 0, 0},
+	}
+	for _, c := range cases {
+		if got := policy.LockDurationAfter(c.failedAttempts, c.threshold); got != c.want {
+			t.Errorf("LockDurationAfter(%d, %d) = %s, want %s", c.failedAttempts, c.threshold, got, c.want)
+		}
+	}
+}
+
+func TestParseLockoutPolicy(t *testing.T) {
+	policy, err := ParseLockoutPolicy(`{"max_failed_attempts": 3, "max_entity_failed_attempts": 0, "lock_duration": "30s"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := LockoutPolicy{
+		MaxFailedAttempts:       3,
+		MaxEntityFailedAttempts: 0,
+		LockDuration:            30 * time.Second,
+		MaxLockDuration:         DefaultLockoutPolicy.MaxLockDuration,
+		FailureWindow:           DefaultLockoutPolicy.FailureWindow,
+	}
+	if policy != want {
+		t.Fatalf("policy = %+v, want %+v", policy, want)
+	}
+
+	if _, err := ParseLockoutPolicy(`{"lock_duration": "2h"}`); err == nil {
+		t.Fatal("lock duration above the maximum accepted")
+	}
+	if _, err := ParseLockoutPolicy(`{"lock_duration": "0s"}`); err == nil {
+		t.Fatal("zero lock duration accepted")
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor authenticates every unary call from its "authorization" metadata and puts the
+// Principal into the handler's context.
+func UnaryServerInterceptor(a *Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authenticateIncoming(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authenticates every stream like UnaryServerInterceptor, exposing the Principal through the stream's context.
+func StreamServerInterceptor(a *Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticateIncoming(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Authenticator) authenticateIncoming(ctx context.Context) (context.Context, error) {
+	header := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	token, err := BearerToken(header)
+	if err == nil {
+		var principal *Principal
+		principal, err = a.Authenticate(ctx, token)
+		if err == nil {
+			return NewContext(ctx, principal), nil
+		}
+	}
+
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		return nil, status.Error(codes.Unavailable, "authentication unavailable")
+	}
+	return nil, status.Error(codes.Unauthenticated, authErr.Error())
+}
+
+// TokenSource supplies the bearer token for outgoing calls.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc adapts a function to a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// StaticToken always supplies token, e.g. a service account token.
+func StaticToken(token string) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+// ForwardedToken passes on the token the current request was authenticated with, so a service can call
+// another one on behalf of the same entity.
+var ForwardedToken TokenSource = TokenSourceFunc(func(ctx context.Context) (string, error) {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	return principal.Token, nil
+})
+
+// UnaryClientInterceptor attaches the token from source to every outgoing unary call. Calls go out
+// without a token when source returns an empty one.
+func UnaryClientInterceptor(source TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := withOutgoingToken(ctx, source)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor attaches the token from source to every outgoing stream, like UnaryClientInterceptor.
+func StreamClientInterceptor(source TokenSource) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := withOutgoingToken(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func withOutgoingToken(ctx context.Context, source TokenSource) (context.Context, error) {
+	token, err := source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return ctx, nil
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), nil
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type entityHealthServer struct {
+	*health.Server
+	entities chan uuid.UUID
+}
+
+func (s *entityHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	entity, _ := EntityFromContext(ctx)
+	s.entities <- entity
+	return s.Server.Check(ctx, req)
+}
+
+func (s *entityHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	entity, _ := EntityFromContext(stream.Context())
+	s.entities <- entity
+	return s.Server.Watch(req, stream)
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	signer, validator := newTestValidator(t)
+	authenticator := NewAuthenticator(validator)
+	entity := uuid.New()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(authenticator)),
+		grpc.StreamInterceptor(StreamServerInterceptor(authenticator)),
+	)
+	healthServer := &entityHealthServer{Server: health.NewServer(), entities: make(chan uuid.UUID, 2)}
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	dial := func(source TokenSource) healthpb.HealthClient {
+		conn, err := grpc.NewClient("passthrough:///bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithUnaryInterceptor(UnaryClientInterceptor(source)),
+			grpc.WithStreamInterceptor(StreamClientInterceptor(source)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return healthpb.NewHealthClient(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := dial(StaticToken(newTestToken(t, signer, entity, "session", time.Now().Add(time.Minute))))
+
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-healthServer.entities; got != entity {
+		t.Fatalf("unary handler saw entity %v, want %v", got, entity)
+	}
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-healthServer.entities; got != entity {
+		t.Fatalf("stream handler saw entity %v, want %v", got, entity)
+	}
+
+	for name, source := range map[string]TokenSource{
+		"missing": StaticToken(""),
+		"expired": StaticToken(newTestToken(t, signer, entity, "session", time.Now().Add(-time.Minute))),
+	} {
+		client := dial(source)
+		if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: unary call error = %v, want Unauthenticated", name, err)
+		}
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s: stream call error = %v, want Unauthenticated", name, err)
+		}
+	}
+}
+
+func TestForwardedToken(t *testing.T) {
+	ctx := NewContext(context.Background(), &Principal{Token: "token"})
+	if token, _ := ForwardedToken.Token(ctx); token != "token" {
+		t.Fatalf("forwarded token = %q", token)
+	}
+	if token, _ := ForwardedToken.Token(context.Background()); token != "" {
+		t.Fatalf("forwarded token without principal = %q", token)
+	}
+}
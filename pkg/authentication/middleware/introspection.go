@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+)
+
+// Introspector is satisfied by *authentication.DALPostgres, IntrospectionClient and CachedIntrospector.
+type Introspector interface {
+	IntrospectToken(ctx context.Context, req *authentication.IntrospectTokenRequest) (*authentication.IntrospectTokenResponse, error)
+}
+
+// IntrospectionClient calls the authentication-introspect-token function over HTTP.
+type IntrospectionClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+func NewIntrospectionClient(endpoint string, httpClient *http.Client) *IntrospectionClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &IntrospectionClient{endpoint: endpoint, httpClient: httpClient}
+}
+
+func (c *IntrospectionClient) IntrospectToken(ctx context.Context, req *authentication.IntrospectTokenRequest) (*authentication.IntrospectTokenResponse, error) {
+	form := url.Values{"token": {req.Token}}
+	if req.TokenTypeHint != "" {
+		form.Set("token_type_hint", req.TokenTypeHint)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %s", httpResp.Status)
+	}
+
+	var resp authentication.IntrospectTokenResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+const cachedIntrospectorMaxEntries = 10000
+
+type cachedIntrospection struct {
+	resp      *authentication.IntrospectTokenResponse
+	expiresAt time.Time
+}
+
+// CachedIntrospector remembers introspection results for up to ttl, and never past the token's own expiry.
+// A revoked token may therefore be accepted for up to ttl after revocation.
+type CachedIntrospector struct {
+	next Introspector
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedIntrospection
+}
+
+func NewCachedIntrospector(next Introspector, ttl time.Duration) *CachedIntrospector {
+	return &CachedIntrospector{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedIntrospection),
+	}
+}
+
+func (c *CachedIntrospector) IntrospectToken(ctx context.Context, req *authentication.IntrospectTokenRequest) (*authentication.IntrospectTokenResponse, error) {
+	key := req.TokenTypeHint + ":" + authentication.HashToken(req.Token)
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.resp, nil
+	}
+
+	resp, err := c.next.IntrospectToken(ctx, req)
+	if err != nil || !resp.Valid {
+		return resp, err
+	}
+
+	expiresAt := now.Add(c.ttl)
+	if resp.Active && resp.ExpiresAt != 0 && time.Unix(resp.ExpiresAt, 0).Before(expiresAt) {
+		expiresAt = time.Unix(resp.ExpiresAt, 0)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= cachedIntrospectorMaxEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= cachedIntrospectorMaxEntries {
+			c.entries = make(map[string]cachedIntrospection)
+		}
+	}
+	c.entries[key] = cachedIntrospection{resp: resp, expiresAt: expiresAt}
+
+	return resp, nil
+}
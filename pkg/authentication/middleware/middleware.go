@@ -0,0 +1,259 @@
+// Package middleware verifies bearer tokens issued by the authentication service in downstream services.
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// RFC 6750 error codes.
+const (
+	ErrorCodeInvalidRequest = "invalid_request"
+	ErrorCodeInvalidToken   = "invalid_token"
+)
+
+// AuthError describes why a request was not authenticated. An empty Code means no credentials were sent.
+type AuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *AuthError) Error() string {
+	if e.Code == "" {
+		return "missing bearer token"
+	}
+	return e.Code + ": " + e.Description
+}
+
+var errMissingToken = &AuthError{}
+
+type Principal struct {
+	Entity uuid.UUID
+	Claims *authentication.AccessTokenClaims
+	Token  string
+}
+
+type Option func(a *Authenticator)
+
+// WithRealm sets the realm reported in WWW-Authenticate challenges.
+func WithRealm(realm string) Option {
+	return func(a *Authenticator) {
+		a.realm = realm
+	}
+}
+
+// WithRevocationCheck asks introspector whether each token is still active, so logged out sessions are
+// rejected before their tokens expire. Opaque tokens are only accepted when this is set.
+// Wrap remote introspection in NewCachedIntrospector to avoid a round trip per request.
+func WithRevocationCheck(introspector Introspector) Option {
+	return func(a *Authenticator) {
+		a.introspector = introspector
+	}
+}
+
+type Authenticator struct {
+	validator    *authentication.TokenValidator
+	introspector Introspector
+	realm        string
+}
+
+func NewAuthenticator(validator *authentication.TokenValidator, opts ...Option) *Authenticator {
+	a := &Authenticator{validator: validator}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Authenticate verifies an access token. Refresh tokens are rejected. Errors are either an *AuthError
+// or a failure to reach the introspector.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, errMissingToken
+	}
+
+	var claims *authentication.AccessTokenClaims
+	if isJWT(token) {
+		var err error
+		claims, err = a.validator.Validate(token)
+		if err != nil {
+			return nil, &AuthError{Code: ErrorCodeInvalidToken, Description: err.Error()}
+		}
+		// Only access tokens carry a session id.
+		if claims.SessionID == "" {
+			return nil, &AuthError{Code: ErrorCodeInvalidToken, Description: "not an access token"}
+		}
+	} else if a.introspector == nil {
+		return nil, &AuthError{Code: ErrorCodeInvalidToken, Description: "malformed token"}
+	}
+
+	if a.introspector != nil {
+		resp, err := a.introspector.IntrospectToken(ctx, &authentication.IntrospectTokenRequest{
+			Token:         token,
+			TokenTypeHint: authentication.TokenTypeAccessToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Valid {
+			return nil, errors.New(resp.Error)
+		}
+		if !resp.Active || resp.TokenType != authentication.TokenTypeAccessToken {
+			return nil, &AuthError{Code: ErrorCodeInvalidToken, Description: "token is not active"}
+		}
+		if claims == nil {
+			claims = claimsFromIntrospection(resp)
+		}
+	}
+
+	entity, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, &AuthError{Code: ErrorCodeInvalidToken, Description: "invalid subject"}
+	}
+
+	return &Principal{Entity: entity, Claims: claims, Token: token}, nil
+}
+
+// RequireAuth rejects requests without a valid bearer token and passes the rest on with the Principal in their context.
+func RequireAuth(validator *authentication.TokenValidator, opts ...Option) func(http.Handler) http.Handler {
+	return NewAuthenticator(validator, opts...).RequireAuth
+}
+
+func (a *Authenticator) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+
+		principal, err := a.Authenticate(r.Context(), token)
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+	})
+}
+
+// BearerToken extracts the token from an Authorization header value. An empty header yields an empty token.
+func BearerToken(header string) (string, error) {
+	if header == "" {
+		return "", nil
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", errMissingToken
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", &AuthError{Code: ErrorCodeInvalidRequest, Description: "malformed bearer token"}
+	}
+	return token, nil
+}
+
+func (a *Authenticator) writeError(w http.ResponseWriter, err error) {
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		http.Error(w, "authentication unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	status := http.StatusUnauthorized
+	if authErr.Code == ErrorCodeInvalidRequest {
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("WWW-Authenticate", a.challenge(authErr))
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (a *Authenticator) challenge(err *AuthError) string {
+	params := make([]string, 0, 3)
+	if a.realm != "" {
+		params = append(params, `realm="`+quote(a.realm)+`"`)
+	}
+	if err.Code != "" {
+		params = append(params, `error="`+err.Code+`"`)
+		if err.Description != "" {
+			params = append(params, `error_description="`+quote(err.Description)+`"`)
+		}
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// quote drops characters RFC 6750 does not allow in auth-param values.
+func quote(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+func EntityFromContext(ctx context.Context) (uuid.UUID, bool) {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return principal.Entity, true
+}
+
+func ClaimsFromContext(ctx context.Context) (*authentication.AccessTokenClaims, bool) {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return principal.Claims, true
+}
+
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func claimsFromIntrospection(resp *authentication.IntrospectTokenResponse) *authentication.AccessTokenClaims {
+	claims := &authentication.AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   resp.Issuer,
+			Subject:  resp.Subject,
+			Audience: resp.Audience,
+			ID:       resp.JWTID,
+		},
+		EmailVerified:    resp.EmailVerified,
+		PublicIdentifier: resp.Username,
+		SessionID:        resp.SessionID,
+	}
+	if resp.ExpiresAt != 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(resp.ExpiresAt, 0))
+	}
+	if resp.IssuedAt != 0 {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(resp.IssuedAt, 0))
+	}
+	if resp.NotBefore != 0 {
+		claims.NotBefore = jwt.NewNumericDate(time.Unix(resp.NotBefore, 0))
+	}
+	return claims
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CoreKitMDK/corekit-service-authentication/v2/pkg/authentication"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type fakeIntrospector struct {
+	calls  int
+	active map[string]bool
+}
+
+func (f *fakeIntrospector) IntrospectToken(ctx context.Context, req *authentication.IntrospectTokenRequest) (*authentication.IntrospectTokenResponse, error) {
+	f.calls++
+	if !f.active[req.Token] {
+		return &authentication.IntrospectTokenResponse{Active: false, Valid: true}, nil
+	}
+	return &authentication.IntrospectTokenResponse{
+		Active:    true,
+		TokenType: authentication.TokenTypeAccessToken,
+		Subject:   "5f0c7d4e-8f5e-4c1e-9a57-3c7f1d2b9e10",
+		SessionID: "session",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		Valid:     true,
+	}, nil
+}
+
+func newTestValidator(t *testing.T) (*authentication.AsymmetricSigner, *authentication.TokenValidator) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := authentication.NewSigner("test", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, authentication.NewTokenValidator(signer, authentication.TokenValidationPolicy{Issuer: "https://test.com"})
+}
+
+func newTestToken(t *testing.T, signer authentication.Signer, entity uuid.UUID, sessionID string, expiresAt time.Time) string {
+	t.Helper()
+
+	now := time.Now()
+	token, err := authentication.GenerateJWTWithClaims(&authentication.AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://test.com",
+			Subject:   entity.String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti",
+		},
+		SessionID: sessionID,
+	}, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequireAuth(t *testing.T) {
+	signer, validator := newTestValidator(t)
+	entity := uuid.New()
+
+	handler := RequireAuth(validator, WithRealm("test"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := EntityFromContext(r.Context())
+		if !ok || got != entity {
+			t.Errorf("entity in context = %v, want %v", got, entity)
+		}
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || claims.SessionID != "session" {
+			t.Errorf("claims missing from context")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{"valid", "Bearer " + newTestToken(t, signer, entity, "session", time.Now().Add(time.Minute)), http.StatusNoContent, ""},
+		{"missing", "", http.StatusUnauthorized, `Bearer realm="test"`},
+		{"other scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, `Bearer realm="test"`},
+		{"malformed", "Bearer a b", http.StatusBadRequest, `Bearer realm="test", error="invalid_request"`},
+		{"expired", "Bearer " + newTestToken(t, signer, entity, "session", time.Now().Add(-time.Minute)), http.StatusUnauthorized, `Bearer realm="test", error="invalid_token"`},
+		{"refresh token", "Bearer " + newTestToken(t, signer, entity, "", time.Now().Add(time.Minute)), http.StatusUnauthorized, `Bearer realm="test", error="invalid_token"`},
+		{"opaque without introspection", "Bearer abc.def", http.StatusUnauthorized, `Bearer realm="test", error="invalid_token"`},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Errorf("%s: status = %d, want %d", c.name, rec.Code, c.status)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, c.challenge) {
+			t.Errorf("%s: WWW-Authenticate = %q, want prefix %q", c.name, got, c.challenge)
+		}
+	}
+}
+
+func TestRequireAuthRevocationCheck(t *testing.T) {
+	signer, validator := newTestValidator(t)
+	entity := uuid.New()
+
+	active := newTestToken(t, signer, entity, "session", time.Now().Add(time.Minute))
+	revoked := newTestToken(t, signer, entity, "revoked", time.Now().Add(time.Minute))
+
+	introspector := &fakeIntrospector{active: map[string]bool{active: true, "abc.def": true}}
+	cached := NewCachedIntrospector(introspector, time.Minute)
+	handler := RequireAuth(validator, WithRevocationCheck(cached))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(active); code != http.StatusNoContent {
+		t.Fatalf("active token: status = %d", code)
+	}
+	if code := serve(active); code != http.StatusNoContent {
+		t.Fatalf("active token: status = %d", code)
+	}
+	if introspector.calls != 1 {
+		t.Fatalf("introspection was not cached: %d calls", introspector.calls)
+	}
+	if code := serve(revoked); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: status = %d", code)
+	}
+	if code := serve("abc.def"); code != http.StatusNoContent {
+		t.Fatalf("opaque token: status = %d", code)
+	}
+}
@@ -3,8 +3,12 @@ package authentication
 import "github.com/google/uuid"
 
 type LoginPasswordRequest struct {
-	Identifier string `json:"identifier"`
-	Password   string `json:"password"`
+	Identifier string     `json:"identifier"`
+	Password   string     `json:"password"`
+	ClientType ClientType `json:"client_type,omitempty"`
+	// Audience the tokens are issued for, which must be one of the DAL's audiences or, without those, one named
+	// by the lifetime policy. Empty means all of the DAL's audiences.
+	Audience string `json:"audience,omitempty"`
 
 	IPAddress         *string `json:"ip_address,omitempty"`
 	UserAgent         *string `json:"user_agent,omitempty"`
@@ -21,10 +25,14 @@ type LoginRefreshTokenRequest struct {
 }
 
 type RegisterPasswordRequest struct {
-	Password         string  `json:"password"`
-	PrimaryEmail     string  `json:"primary_email"`
-	PublicIdentifier string  `json:"public_identifier"`
-	PrimaryPhone     *string `json:"primary_phone,omitempty"`
+	Password         string     `json:"password"`
+	PrimaryEmail     string     `json:"primary_email"`
+	PublicIdentifier string     `json:"public_identifier"`
+	PrimaryPhone     *string    `json:"primary_phone,omitempty"`
+	ClientType       ClientType `json:"client_type,omitempty"`
+	// Audience the tokens are issued for, which must be one of the DAL's audiences or, without those, one named
+	// by the lifetime policy. Empty means all of the DAL's audiences.
+	Audience string `json:"audience,omitempty"`
 
 	IPAddress         *string `json:"ip_address,omitempty"`
 	UserAgent         *string `json:"user_agent,omitempty"`
@@ -114,3 +122,88 @@ type DeleteEntityRequest struct {
 type GetEntityDetailsRequest struct {
 	Entity uuid.UUID `json:"entity"`
 }
+
+type GetJWKSRequest struct {
+}
+
+type RotateSigningKeyRequest struct {
+}
+
+// RFC 7662 token introspection request
+type IntrospectTokenRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint,omitempty"`
+}
+
+type ListSessionsRequest struct {
+	Entity uuid.UUID `json:"entity"`
+	// Access or refresh token of the caller, used to mark their current session.
+	Token string `json:"token,omitempty"`
+
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+type RevokeSessionRequest struct {
+	Entity  uuid.UUID `json:"entity"`
+	Session uuid.UUID `json:"session"`
+
+	IPAddress         *string `json:"ip_address,omitempty"`
+	UserAgent         *string `json:"user_agent,omitempty"`
+	DeviceFingerprint *string `json:"device_fingerprint,omitempty"`
+}
+
+type UpdatePasswordRequest struct {
+	Entity          uuid.UUID `json:"entity"`
+	CurrentPassword string    `json:"current_password"`
+	NewPassword     string    `json:"new_password"`
+
+	// RevokeOtherSessions signs out every session except the one Token belongs to, or all of them without a Token.
+	RevokeOtherSessions bool   `json:"revoke_other_sessions,omitempty"`
+	Token               string `json:"token,omitempty"`
+
+	IPAddress         *string `json:"ip_address,omitempty"`
+	UserAgent         *string `json:"user_agent,omitempty"`
+	DeviceFingerprint *string `json:"device_fingerprint,omitempty"`
+}
+
+type UnlockEntityRequest struct {
+	Entity uuid.UUID `json:"entity"`
+	Reason string    `json:"reason"`
+
+	IPAddress         *string `json:"ip_address,omitempty"`
+	UserAgent         *string `json:"user_agent,omitempty"`
+	DeviceFingerprint *string `json:"device_fingerprint,omitempty"`
+}
+
+type EnrollTOTPRequest struct {
+	Entity uuid.UUID `json:"entity"`
+}
+
+type ConfirmTOTPRequest struct {
+	Entity uuid.UUID `json:"entity"`
+	Code   string    `json:"code"`
+
+	IPAddress         *string `json:"ip_address,omitempty"`
+	UserAgent         *string `json:"user_agent,omitempty"`
+	DeviceFingerprint *string `json:"device_fingerprint,omitempty"`
+}
+
+type VerifyTOTPRequest struct {
+	Entity uuid.UUID `json:"entity"`
+	Code   string    `json:"code"`
+
+	IPAddress         *string `json:"ip_address,omitempty"`
+	UserAgent         *string `json:"user_agent,omitempty"`
+	DeviceFingerprint *string `json:"device_fingerprint,omitempty"`
+}
+
+type DisableTOTPRequest struct {
+	Entity uuid.UUID `json:"entity"`
+	// A current code, needed once the TOTP method was confirmed.
+	Code string `json:"code,omitempty"`
+
+	IPAddress         *string `json:"ip_address,omitempty"`
+	UserAgent         *string `json:"user_agent,omitempty"`
+	DeviceFingerprint *string `json:"device_fingerprint,omitempty"`
+}
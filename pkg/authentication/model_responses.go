@@ -11,6 +11,13 @@ type LoginPasswordResponse struct {
 	RefreshToken          string `json:"refresh_token"`
 	RefreshTokenExpiresAt int64  `json:"refresh_token_expires_at"`
 
+	// Sessions signed out to stay within the active session limit.
+	EvictedSessions []uuid.UUID `json:"evicted_sessions,omitempty"`
+
+	// ErrorCode tells refused logins apart, e.g. ErrorCodeAccountLocked until LockedUntil.
+	ErrorCode   string `json:"error_code,omitempty"`
+	LockedUntil int64  `json:"locked_until,omitempty"`
+
 	Valid bool   `json:"valid"`
 	Error string `json:"error"`
 }
@@ -21,8 +28,14 @@ type LoginRefreshTokenResponse struct {
 	Token          string `json:"token"`
 	TokenExpiresAt int64  `json:"token_expires_at"`
 
-	RefreshToken          string `json:"refresh_token"`            // TODO
-	RefreshTokenExpiresAt int64  `json:"refresh_token_expires_at"` //TODO
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresAt int64  `json:"refresh_token_expires_at"`
+
+	// Sessions signed out to stay within the active session limit.
+	EvictedSessions []uuid.UUID `json:"evicted_sessions,omitempty"`
+
+	// Set when the refresh was allowed despite a device binding mismatch.
+	Warning string `json:"warning,omitempty"`
 
 	Valid bool   `json:"valid"`
 	Error string `json:"error"`
@@ -37,6 +50,12 @@ type RegisterPasswordResponse struct {
 	RefreshToken          string `json:"refresh_token"`
 	RefreshTokenExpiresAt int64  `json:"refresh_token_expires_at"`
 
+	// Sessions signed out to stay within the active session limit.
+	EvictedSessions []uuid.UUID `json:"evicted_sessions,omitempty"`
+
+	// Set when the password was refused by the password policy.
+	PasswordViolations []PasswordViolation `json:"password_violations,omitempty"`
+
 	Valid bool   `json:"valid"`
 	Error string `json:"error"`
 }
@@ -47,6 +66,16 @@ type RefreshTokenResponse struct {
 	Token          string `json:"token"`
 	TokenExpiresAt int64  `json:"token_expires_at"`
 
+	// Same as the presented refresh token unless refresh token rotation is enabled.
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresAt int64  `json:"refresh_token_expires_at"`
+
+	// Sessions signed out to stay within the active session limit.
+	EvictedSessions []uuid.UUID `json:"evicted_sessions,omitempty"`
+
+	// Set when the refresh was allowed despite a device binding mismatch.
+	Warning string `json:"warning,omitempty"`
+
 	Valid bool   `json:"valid"`
 	Error string `json:"error"`
 }
@@ -98,6 +127,9 @@ type ForgotPasswordResponse struct {
 type ChangePasswordResponse struct {
 	Entity uuid.UUID `json:"entity"`
 
+	// Set when the password was refused by the password policy.
+	PasswordViolations []PasswordViolation `json:"password_violations,omitempty"`
+
 	Valid bool   `json:"valid"`
 	Error string `json:"error"`
 }
@@ -115,3 +147,135 @@ type GetEntityDetailsResponse struct {
 	Valid bool   `json:"valid"`
 	Error string `json:"error"`
 }
+
+type GetJWKSResponse struct {
+	JWKS *JWKS `json:"jwks"`
+
+	// Seconds verifiers may cache the key set for.
+	CacheMaxAge int64 `json:"cache_max_age"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type RotateSigningKeyResponse struct {
+	KeyID string `json:"kid"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+// RFC 7662 token introspection response. Only Active is set for inactive tokens.
+type IntrospectTokenResponse struct {
+	Active bool `json:"active"`
+
+	TokenType string   `json:"token_type,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	JWTID     string   `json:"jti,omitempty"`
+
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	SessionID     string `json:"sid,omitempty"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+// A signed-in session, represented by its active refresh token.
+type EntitySession struct {
+	ID                uuid.UUID  `json:"id"`
+	ClientType        ClientType `json:"client_type,omitempty"`
+	IPAddress         *string    `json:"ip_address,omitempty"`
+	UserAgent         *string    `json:"user_agent,omitempty"`
+	DeviceFingerprint *string    `json:"device_fingerprint,omitempty"`
+	CreatedAt         int64      `json:"created_at"`
+	LastUsedAt        *int64     `json:"last_used_at,omitempty"`
+	ExpiresAt         int64      `json:"expires_at"`
+	Current           bool       `json:"current"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []*EntitySession `json:"sessions"`
+	Total    int              `json:"total"`
+	Limit    int              `json:"limit"`
+	Offset   int              `json:"offset"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type RevokeSessionResponse struct {
+	Entity  uuid.UUID `json:"entity"`
+	Session uuid.UUID `json:"session"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type UpdatePasswordResponse struct {
+	Entity          uuid.UUID `json:"entity"`
+	RevokedSessions int64     `json:"revoked_sessions"`
+
+	// Set when the new password was refused by the password policy or history.
+	PasswordViolations []PasswordViolation `json:"password_violations,omitempty"`
+
+	// ErrorCode tells refused logins apart, e.g. ErrorCodeAccountLocked until LockedUntil.
+	ErrorCode   string `json:"error_code,omitempty"`
+	LockedUntil int64  `json:"locked_until,omitempty"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type UnlockEntityResponse struct {
+	Entity uuid.UUID `json:"entity"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type EnrollTOTPResponse struct {
+	Entity uuid.UUID `json:"entity"`
+
+	// Base32 secret for manual entry, and the otpauth URI to show as a QR code.
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type ConfirmTOTPResponse struct {
+	Entity uuid.UUID `json:"entity"`
+
+	ErrorCode   string `json:"error_code,omitempty"`
+	LockedUntil int64  `json:"locked_until,omitempty"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type VerifyTOTPResponse struct {
+	Entity uuid.UUID `json:"entity"`
+
+	ErrorCode   string `json:"error_code,omitempty"`
+	LockedUntil int64  `json:"locked_until,omitempty"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+type DisableTOTPResponse struct {
+	Entity uuid.UUID `json:"entity"`
+
+	ErrorCode   string `json:"error_code,omitempty"`
+	LockedUntil int64  `json:"locked_until,omitempty"`
+
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
@@ -21,7 +21,7 @@ type EntityToken struct {
 	ID                uuid.UUID `json:"id"`
 	EntityID          uuid.UUID `json:"entity_id"`
 	RefreshTokenID    uuid.UUID `json:"refresh_token_id"`
-	Token             string    `json:"token"`
+	TokenHash         string    `json:"token_hash"`
 	TokenRandomID     string    `json:"token_random_id"`
 	IPAddress         *string   `json:"ip_address,omitempty"`
 	UserAgent         *string   `json:"user_agent,omitempty"`
@@ -35,19 +35,23 @@ type EntityToken struct {
 }
 
 type EntityRefreshToken struct {
-	ID                uuid.UUID `json:"id"`
-	EntityID          uuid.UUID `json:"entity_id"`
-	Token             string    `json:"token"`
-	TokenRandomID     string    `json:"token_random_id"`
-	IPAddress         *string   `json:"ip_address,omitempty"`
-	UserAgent         *string   `json:"user_agent,omitempty"`
-	DeviceFingerprint *string   `json:"device_fingerprint,omitempty"`
-	UsageCount        int       `json:"usage_count"`
-	LastUsedAt        *int64    `json:"last_used_at,omitempty"`
-	CreatedAt         int64     `json:"created_at"`
-	ExpiresAt         int64     `json:"expires_at"`
-	RevokedAt         *int64    `json:"revoked_at,omitempty"`
-	Active            bool      `json:"active"`
+	ID                uuid.UUID  `json:"id"`
+	EntityID          uuid.UUID  `json:"entity_id"`
+	FamilyID          uuid.UUID  `json:"family_id"`
+	ParentID          *uuid.UUID `json:"parent_id,omitempty"`
+	TokenHash         string     `json:"token_hash"`
+	TokenRandomID     string     `json:"token_random_id"`
+	ClientType        ClientType `json:"client_type,omitempty"`
+	IPAddress         *string    `json:"ip_address,omitempty"`
+	UserAgent         *string    `json:"user_agent,omitempty"`
+	DeviceFingerprint *string    `json:"device_fingerprint,omitempty"`
+	UsageCount        int        `json:"usage_count"`
+	LastUsedAt        *int64     `json:"last_used_at,omitempty"`
+	CreatedAt         int64      `json:"created_at"`
+	ExpiresAt         int64      `json:"expires_at"`
+	RotatedAt         *int64     `json:"rotated_at,omitempty"`
+	RevokedAt         *int64     `json:"revoked_at,omitempty"`
+	Active            bool       `json:"active"`
 }
 
 type EntityLoginMethod struct {
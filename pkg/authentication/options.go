@@ -0,0 +1,112 @@
+package authentication
+
+type DALOption func(dal *DALPostgres)
+
+// WithClaimsEnricher runs enricher for every access token the DAL issues.
+func WithClaimsEnricher(enricher ClaimsEnricher) DALOption {
+	return func(dal *DALPostgres) {
+		dal.claimsEnricher = enricher
+	}
+}
+
+// WithRefreshTokenRotation makes every refresh return a new refresh token and retire the presented one.
+// Presenting a retired refresh token again revokes its whole token family.
+func WithRefreshTokenRotation() DALOption {
+	return func(dal *DALPostgres) {
+		dal.rotateRefreshTokens = true
+	}
+}
+
+// WithTokenFormat selects whether access and refresh tokens are issued as JWTs (default) or opaque reference tokens.
+// Tokens already issued in the other format keep working.
+func WithTokenFormat(format TokenFormat) DALOption {
+	return func(dal *DALPostgres) {
+		dal.tokenFormat = format
+	}
+}
+
+// WithTokenValidationPolicy replaces the default policy, which requires the DAL's issuer, one of its
+// audiences (if any) and the sub, exp and jti claims.
+func WithTokenValidationPolicy(policy TokenValidationPolicy) DALOption {
+	return func(dal *DALPostgres) {
+		dal.validationPolicy = &policy
+	}
+}
+
+// WithTokenLifetimePolicy replaces DefaultTokenLifetimePolicy for every path that issues tokens.
+func WithTokenLifetimePolicy(policy TokenLifetimePolicy) DALOption {
+	return func(dal *DALPostgres) {
+		dal.lifetimePolicy = policy
+	}
+}
+
+// WithSessionLimit caps how many sessions an entity may have active at once. Zero or less means no limit,
+// and an empty policy means SessionLimitReject.
+func WithSessionLimit(maxActiveSessions int, policy SessionLimitPolicy) DALOption {
+	return func(dal *DALPostgres) {
+		dal.maxActiveSessions = maxActiveSessions
+		dal.sessionLimitPolicy = policy
+	}
+}
+
+// WithDeviceBinding checks that refresh tokens are used from the device they were issued to.
+func WithDeviceBinding(policy DeviceBindingPolicy) DALOption {
+	return func(dal *DALPostgres) {
+		dal.deviceBinding = policy
+	}
+}
+
+// WithPasswordHasher sets how new passwords are hashed. Existing hashes of another algorithm or with other
+// parameters keep verifying and are replaced on the next successful LoginPassword.
+func WithPasswordHasher(hasher PasswordHasher) DALOption {
+	return func(dal *DALPostgres) {
+		dal.passwordHasher = hasher
+	}
+}
+
+// WithPasswordPolicy checks new passwords in RegisterPassword and ChangePassword. Without it any password is accepted.
+func WithPasswordPolicy(policy PasswordPolicy) DALOption {
+	return func(dal *DALPostgres) {
+		dal.passwordPolicy = &policy
+	}
+}
+
+// WithPasswordHistory rejects new passwords matching any of the entity's last depth passwords, the current one included.
+func WithPasswordHistory(depth int) DALOption {
+	return func(dal *DALPostgres) {
+		dal.passwordHistoryDepth = depth
+	}
+}
+
+// WithLockoutPolicy locks login methods and entities after repeated failed logins. Without it guesses are not limited.
+func WithLockoutPolicy(policy LockoutPolicy) DALOption {
+	return func(dal *DALPostgres) {
+		dal.lockoutPolicy = &policy
+	}
+}
+
+// WithEnumerationProtection makes LoginPassword, RegisterPassword and ForgotPassword answer the same whether
+// or not an email is registered, and hands what differs to notifier instead. RegisterPassword then issues no tokens,
+// and a locked login answers like a wrong password while the owner is told about the lock by notifier.
+func WithEnumerationProtection(notifier Notifier) DALOption {
+	return func(dal *DALPostgres) {
+		dal.notifier = notifier
+	}
+}
+
+// WithPepper keys new password hashes with the current version of pepper. Hashes without a pepper or with an
+// older version keep verifying and are replaced on the next successful LoginPassword.
+func WithPepper(pepper Pepper) DALOption {
+	return func(dal *DALPostgres) {
+		dal.pepper = &pepper
+	}
+}
+
+// WithTOTP enables EnrollTOTP and the other TOTP methods. Secrets are sealed with keys; combine it with
+// WithLockoutPolicy, or codes can be guessed without limit.
+func WithTOTP(policy TOTPPolicy, keys EncryptionKeys) DALOption {
+	return func(dal *DALPostgres) {
+		dal.totpPolicy = policy
+		dal.totpKeys = &keys
+	}
+}
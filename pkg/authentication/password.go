@@ -0,0 +1,189 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, which must be in this hasher's format.
+	Verify(hash string, password string) (bool, error)
+	// Identifies reports whether hash was produced by this hasher's algorithm, with any parameters.
+	Identifies(hash string) bool
+	// NeedsRehash reports whether hash was produced with other parameters than the hasher's current ones.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idHasher produces PHC strings: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idHasher uses the second recommended parameter set of RFC 9106.
+var DefaultArgon2idHasher = &Argon2idHasher{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const argon2idPrefix = "$argon2id$"
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(hash string, password string) (bool, error) {
+	params, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory || params.Iterations != h.Iterations || params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength || uint32(len(key)) != h.KeyLength
+}
+
+// Stored parameters are bounded before hashing with them, since argon2 panics on zero iterations or
+// parallelism and allocates the full memory cost.
+const (
+	maxArgon2idMemory     = 1024 * 1024
+	maxArgon2idIterations = 100
+)
+
+func parseArgon2idHash(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, err
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, err
+	}
+	if params.Memory == 0 || params.Memory > maxArgon2idMemory ||
+		params.Iterations == 0 || params.Iterations > maxArgon2idIterations || params.Parallelism == 0 {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id parameters: %s", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(key) == 0 {
+		return nil, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	return params, salt, key, nil
+}
+
+// BcryptHasher verifies hashes created before Argon2id was introduced. Passwords longer than 72 bytes
+// can't be hashed with it.
+type BcryptHasher struct {
+	Cost int
+}
+
+var DefaultBcryptHasher = &BcryptHasher{Cost: bcrypt.DefaultCost}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *BcryptHasher) Verify(hash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// passwordHashers can verify every hash format stored in entity_login_method_password.
+var passwordHashers = []PasswordHasher{DefaultArgon2idHasher, DefaultBcryptHasher}
+
+func passwordHasherFor(hash string) (PasswordHasher, error) {
+	for _, hasher := range passwordHashers {
+		if hasher.Identifies(hash) {
+			return hasher, nil
+		}
+	}
+	return nil, errors.New("unknown password hash format")
+}
+
+// passwordNeedsRehash reports whether hash should be replaced by one from dal.passwordHasher and the
+// current pepper version.
+func (dal *DALPostgres) passwordNeedsRehash(hash string) bool {
+	version, hash, err := splitPepperedHash(hash)
+	if err != nil {
+		return true
+	}
+	if dal.pepper != nil && version != dal.pepper.CurrentVersion {
+		return true
+	}
+	return !dal.passwordHasher.Identifies(hash) || dal.passwordHasher.NeedsRehash(hash)
+}
+
+func (dal *DALPostgres) hashPassword(password string) (string, error) {
+	return hashPassword(dal.passwordHasher, dal.pepper, password)
+}
+
+func (dal *DALPostgres) passwordMatches(hash string, password string) bool {
+	return IsHashSameAsUnhashedStringWithPepper(hash, password, dal.pepper)
+}
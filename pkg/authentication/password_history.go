@@ -0,0 +1,68 @@
+package authentication
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// passwordRecentlyUsed reports whether password matches the current hash or one of the hashes kept in
+// entity_login_method_password_history, which together make up the last passwordHistoryDepth passwords.
+func (dal *DALPostgres) passwordRecentlyUsed(ctx context.Context, db dbtx, methodID uuid.UUID, currentHash string, password string) (bool, error) {
+	if dal.passwordHistoryDepth <= 0 {
+		return false, nil
+	}
+
+	if dal.passwordMatches(currentHash, password) {
+		return true, nil
+	}
+
+	query1 := `SELECT password_hash FROM entity_login_method_password_history WHERE method_id = $1 ORDER BY created_at DESC, id LIMIT $2;`
+	rows, err := db.Query(ctx, query1, methodID, dal.passwordHistoryDepth-1)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	hashes := make([]string, 0)
+	for rows.Next() {
+		var hash string
+		err := rows.Scan(&hash)
+		if err != nil {
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, hash := range hashes {
+		if dal.passwordMatches(hash, password) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPasswordHistory keeps the hash being replaced and prunes history beyond passwordHistoryDepth.
+func (dal *DALPostgres) recordPasswordHistory(ctx context.Context, db dbtx, methodID uuid.UUID, replacedHash string) error {
+	if dal.passwordHistoryDepth <= 1 {
+		return nil
+	}
+
+	query1 := `INSERT INTO entity_login_method_password_history (method_id, password_hash) VALUES ($1, $2);`
+	_, err := db.Exec(ctx, query1, methodID, replacedHash)
+	if err != nil {
+		return err
+	}
+
+	query2 := `DELETE FROM entity_login_method_password_history WHERE method_id = $1 AND id NOT IN (
+				SELECT id FROM entity_login_method_password_history WHERE method_id = $1 ORDER BY created_at DESC, id LIMIT $2);`
+	_, err = db.Exec(ctx, query2, methodID, dal.passwordHistoryDepth-1)
+	return err
+}
+
+func passwordRecentlyUsedViolation(depth int) PasswordViolation {
+	return PasswordViolation{Code: PasswordViolationRecentlyUsed, Message: "Password was used recently", Limit: depth}
+}
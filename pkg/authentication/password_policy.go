@@ -0,0 +1,257 @@
+package authentication
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type PasswordPolicy struct {
+	MinLength int `json:"min_length"`
+	// Zero means no maximum. Argon2id has no length limit, but unbounded input is a denial of service risk.
+	MaxLength int `json:"max_length"`
+	// How many of lowercase, uppercase, digits and symbols the password must mix.
+	MinCharacterClasses int `json:"min_character_classes"`
+	// RejectPersonalInfo rejects passwords containing the email, its local part or the public identifier.
+	RejectPersonalInfo bool `json:"reject_personal_info"`
+	// MinStrengthScore is the lowest accepted EstimatePasswordStrength score, from 0 to 4.
+	MinStrengthScore int `json:"min_strength_score"`
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:           10,
+	MaxLength:           128,
+	MinCharacterClasses: 2,
+	RejectPersonalInfo:  true,
+	MinStrengthScore:    3,
+}
+
+const (
+	PasswordViolationTooShort               = "too_short"
+	PasswordViolationTooLong                = "too_long"
+	PasswordViolationTooFewCharacterClasses = "too_few_character_classes"
+	PasswordViolationContainsPersonalInfo   = "contains_personal_info"
+	PasswordViolationTooWeak                = "too_weak"
+	PasswordViolationRecentlyUsed           = "recently_used"
+)
+
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The limit that was not met: a length, a number of character classes or a strength score.
+	Limit int `json:"limit,omitempty"`
+}
+
+const reasonPasswordPolicy = "Password does not meet the password policy"
+
+// Check returns every rule password breaks. personalInfo holds values like the email and public identifier.
+func (p PasswordPolicy) Check(password string, personalInfo ...string) []PasswordViolation {
+	violations := make([]PasswordViolation, 0)
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{Code: PasswordViolationTooShort, Message: "Password is too short", Limit: p.MinLength})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{Code: PasswordViolationTooLong, Message: "Password is too long", Limit: p.MaxLength})
+	}
+
+	if characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, PasswordViolation{Code: PasswordViolationTooFewCharacterClasses, Message: "Password must mix more kinds of characters", Limit: p.MinCharacterClasses})
+	}
+
+	personalInfo = personalInfoVariants(personalInfo)
+	if p.RejectPersonalInfo {
+		lower := strings.ToLower(password)
+		for _, info := range personalInfo {
+			if strings.Contains(lower, info) {
+				violations = append(violations, PasswordViolation{Code: PasswordViolationContainsPersonalInfo, Message: "Password must not contain your email or public identifier"})
+				break
+			}
+		}
+	}
+
+	if p.MinStrengthScore > 0 {
+		if EstimatePasswordStrength(password, personalInfo...) < p.MinStrengthScore {
+			violations = append(violations, PasswordViolation{Code: PasswordViolationTooWeak, Message: "Password is too easy to guess", Limit: p.MinStrengthScore})
+		}
+	}
+
+	return violations
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// personalInfoVariants lowercases the values and adds the local part of emails, skipping values too short to matter.
+func personalInfoVariants(values []string) []string {
+	variants := make([]string, 0, len(values)*2)
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if local, _, ok := strings.Cut(value, "@"); ok && len(local) >= 3 {
+			variants = append(variants, local)
+		}
+		if len(value) >= 3 {
+			variants = append(variants, value)
+		}
+	}
+	return variants
+}
+
+// Common passwords and words people build passwords from, most common first.
+var commonPasswordWords = []string{
+	"password", "123456", "qwerty", "letmein", "welcome", "admin", "iloveyou", "monkey", "dragon", "football",
+	"baseball", "master", "login", "abc123", "sunshine", "princess", "starwars", "shadow", "superman", "trustno1",
+	"hello", "freedom", "whatever", "secret", "michael", "jordan", "hunter", "ranger", "buster", "soccer",
+	"hockey", "killer", "george", "charlie", "andrew", "thomas", "jessica", "pepper", "ginger", "summer",
+	"winter", "spring", "autumn", "love", "money", "batman", "passw0rd", "changeme", "default", "test",
+	"user", "root", "access", "flower", "cheese", "computer", "internet", "mustang", "corvette", "matrix",
+}
+
+var leetSubstitutions = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// EstimatePasswordStrength scores how hard password is to guess from 0 (trivial) to 4 (strong), on the same
+// scale as zxcvbn. It estimates guesses from dictionary words, userInputs, repeats, sequences and keyboard
+// walks and charges the full character set only for the remaining characters.
+func EstimatePasswordStrength(password string, userInputs ...string) int {
+	if password == "" {
+		return 0
+	}
+
+	// Substitutions replace one byte with one byte, so an index into normalized is also one into remaining.
+	remaining := strings.ToLower(password)
+	normalized := leetSubstitutions.Replace(remaining)
+	log10Guesses := 0.0
+
+	words := make([]string, 0, len(userInputs)+len(commonPasswordWords))
+	for _, input := range userInputs {
+		words = append(words, strings.ToLower(input))
+	}
+	words = append(words, commonPasswordWords...)
+
+	// Each dictionary hit costs about as many guesses as the word's rank in the list.
+	for rank, word := range words {
+		if len(word) < 3 {
+			continue
+		}
+		for {
+			i := strings.Index(normalized, word)
+			if i < 0 {
+				i = strings.Index(remaining, word)
+			}
+			if i < 0 {
+				break
+			}
+			log10Guesses += math.Log10(float64(rank + 2))
+			remaining = remaining[:i] + "\x00" + remaining[i+len(word):]
+			normalized = normalized[:i] + "\x00" + normalized[i+len(word):]
+		}
+	}
+
+	charset := math.Log10(float64(characterSetSize(password)))
+	var prev rune
+	for i, r := range []rune(remaining) {
+		switch {
+		case r == 0:
+		case i > 0 && r == prev:
+			log10Guesses += math.Log10(2)
+		case i > 0 && (r == prev+1 || r == prev-1):
+			log10Guesses += math.Log10(2)
+		case i > 0 && keyboardAdjacent(prev, r):
+			log10Guesses += math.Log10(6)
+		default:
+			log10Guesses += charset
+		}
+		prev = r
+	}
+
+	// Dictionary words and patterns were matched case-insensitively; capitals only add a little.
+	for _, r := range password {
+		if unicode.IsUpper(r) {
+			log10Guesses += math.Log10(2)
+		}
+	}
+
+	switch {
+	case log10Guesses < 3:
+		return 0
+	case log10Guesses < 6:
+		return 1
+	case log10Guesses < 8:
+		return 2
+	case log10Guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func characterSetSize(password string) int {
+	size := 0
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
+
+func keyboardAdjacent(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (dal *DALPostgres) checkPasswordPolicy(password string, personalInfo ...string) []PasswordViolation {
+	if dal.passwordPolicy == nil {
+		return nil
+	}
+	return dal.passwordPolicy.Check(password, personalInfo...)
+}
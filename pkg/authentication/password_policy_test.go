@@ -0,0 +1,55 @@
+package authentication
+
+import "testing"
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	cases := []struct {
+		password string
+		max      int
+		min      int
+	}{
+		{"1234", 0, 0},
+		{"password", 0, 0},
+		{"P@ssw0rd", 1, 0},
+		{"qwertyuiop", 1, 0},
+		{"aaaaaaaaaaaa", 1, 0},
+		{"abcdefgh12345678", 1, 0},
+		{"correct horse battery staple", 4, 4},
+		{"u8#Kq2!vZr9w", 4, 4},
+	}
+	for _, c := range cases {
+		score := EstimatePasswordStrength(c.password)
+		if score > c.max || score < c.min {
+			t.Errorf("EstimatePasswordStrength(%q) = %d, want between %d and %d", c.password, score, c.min, c.max)
+		}
+	}
+
+	if EstimatePasswordStrength("jdoe12", "jdoe") >= EstimatePasswordStrength("jdoe12") {
+		t.Fatal("user inputs should make a password easier to guess")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	codes := func(violations []PasswordViolation) map[string]bool {
+		set := make(map[string]bool, len(violations))
+		for _, v := range violations {
+			set[v.Code] = true
+		}
+		return set
+	}
+
+	got := codes(DefaultPasswordPolicy.Check("1234", "1234@email.com", "test"))
+	for _, code := range []string{PasswordViolationTooShort, PasswordViolationTooFewCharacterClasses, PasswordViolationContainsPersonalInfo, PasswordViolationTooWeak} {
+		if !got[code] {
+			t.Errorf("expected violation %s for 1234", code)
+		}
+	}
+
+	if got := codes(DefaultPasswordPolicy.Check("Janedoe-Moonlit-Harbor-42", "janedoe@email.com", "jd")); !got[PasswordViolationContainsPersonalInfo] || len(got) != 1 {
+		t.Errorf("expected only a personal info violation, got %v", got)
+	}
+
+	if violations := DefaultPasswordPolicy.Check("Moonlit-Harbor-Glass-42", "janedoe@email.com", "jd"); len(violations) != 0 {
+		t.Errorf("expected strong password to pass, got %v", violations)
+	}
+}
@@ -0,0 +1,72 @@
+package authentication
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	// Longer than bcrypt's 72 byte limit, differing only after it.
+	password := strings.Repeat("a", 80) + "1"
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected PHC string: %s", hash)
+	}
+	if ok, err := hasher.Verify(hash, password); err != nil || !ok {
+		t.Fatalf("correct password rejected: %v", err)
+	}
+	if ok, _ := hasher.Verify(hash, strings.Repeat("a", 80)+"2"); ok {
+		t.Fatal("wrong password accepted")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Fatal("hash with current parameters needs rehash")
+	}
+	stronger := &Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	if !stronger.NeedsRehash(hash) {
+		t.Fatal("hash with outdated parameters does not need rehash")
+	}
+
+	// Tampered parameters must be refused rather than crash or exhaust memory.
+	for _, params := range []string{"m=1024,t=0,p=1", "m=1024,t=1,p=0", "m=0,t=1,p=1", "m=4194304,t=1,p=1", "m=1024,t=1000,p=1"} {
+		tampered := strings.Replace(hash, "m=1024,t=1,p=1", params, 1)
+		if ok, err := hasher.Verify(tampered, password); err == nil || ok {
+			t.Fatalf("hash with %s accepted", params)
+		}
+	}
+}
+
+func TestIsHashSameAsUnhashedStringDetectsAlgorithm(t *testing.T) {
+	bcryptHash, err := (&BcryptHasher{Cost: 4}).Hash("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2idHash, err := (&Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []string{bcryptHash, argon2idHash} {
+		if !IsHashSameAsUnhashedString(hash, "1234") {
+			t.Fatalf("correct password rejected for %s", hash)
+		}
+		if IsHashSameAsUnhashedString(hash, "12345") {
+			t.Fatalf("wrong password accepted for %s", hash)
+		}
+	}
+
+	if IsHashSameAsUnhashedString("plaintext", "plaintext") {
+		t.Fatal("unknown hash format accepted")
+	}
+
+	dal := &DALPostgres{passwordHasher: DefaultArgon2idHasher}
+	if !dal.passwordNeedsRehash(bcryptHash) {
+		t.Fatal("bcrypt hash does not need rehash")
+	}
+}
@@ -0,0 +1,116 @@
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Pepper keys password hashes with a secret kept outside the database, so a leaked database alone does not
+// allow guessing passwords. Hashes record the pepper version they were made with: after CurrentVersion is
+// raised, older hashes keep verifying as long as their secret is available and are rehashed on the next login.
+type Pepper struct {
+	Provider SecretProvider
+	// Secrets are read as <Name>-v<version>, e.g. password-pepper-v2.
+	Name           string
+	CurrentVersion int
+}
+
+const (
+	DefaultPepperName  = "password-pepper"
+	pepperedHashPrefix = "$pepper$v="
+)
+
+// ParsePepper reads a pepper from configuration, for example:
+//
+//	{"provider": "kubernetes", "path": "/var/run/secrets/authentication", "current_version": 2}
+//
+// The provider is "env" (path is then the variable prefix), "file" or "kubernetes". The name defaults to
+// DefaultPepperName.
+func ParsePepper(config string) (Pepper, error) {
+	provider, name, version, err := parseVersionedSecretConfig(config, DefaultPepperName)
+	if err != nil {
+		return Pepper{}, err
+	}
+	pepper := Pepper{Provider: provider, Name: name, CurrentVersion: version}
+
+	// Fail on startup rather than on the first registration.
+	if _, err := pepper.secret(pepper.CurrentVersion); err != nil {
+		return Pepper{}, err
+	}
+	return pepper, nil
+}
+
+func (p *Pepper) secret(version int) ([]byte, error) {
+	return versionedSecret(p.Provider, p.Name, version)
+}
+
+// apply keys password with the given pepper version. The HMAC output has a fixed length, which also keeps
+// long passwords within bcrypt's 72 byte limit.
+func (p *Pepper) apply(version int, password string) (string, error) {
+	secret, err := p.secret(version)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// splitPepperedHash returns the pepper version and the hasher's own hash, or version 0 for unpeppered hashes.
+func splitPepperedHash(hash string) (int, string, error) {
+	if !strings.HasPrefix(hash, pepperedHashPrefix) {
+		return 0, hash, nil
+	}
+
+	rest := strings.TrimPrefix(hash, pepperedHashPrefix)
+	end := strings.IndexByte(rest, '$')
+	if end <= 0 {
+		return 0, "", errors.New("invalid peppered hash")
+	}
+	version, err := strconv.Atoi(rest[:end])
+	if err != nil || version <= 0 {
+		return 0, "", errors.New("invalid peppered hash")
+	}
+	return version, rest[end:], nil
+}
+
+func hashPassword(hasher PasswordHasher, pepper *Pepper, password string) (string, error) {
+	if pepper == nil {
+		return hasher.Hash(password)
+	}
+
+	peppered, err := pepper.apply(pepper.CurrentVersion, password)
+	if err != nil {
+		return "", err
+	}
+	hash, err := hasher.Hash(peppered)
+	if err != nil {
+		return "", err
+	}
+	return pepperedHashPrefix + strconv.Itoa(pepper.CurrentVersion) + hash, nil
+}
+
+func verifyPassword(pepper *Pepper, hash string, password string) (bool, error) {
+	version, hash, err := splitPepperedHash(hash)
+	if err != nil {
+		return false, err
+	}
+	if version > 0 {
+		if pepper == nil {
+			return false, errors.New("hash is peppered but no pepper is configured")
+		}
+		if password, err = pepper.apply(version, password); err != nil {
+			return false, err
+		}
+	}
+
+	hasher, err := passwordHasherFor(hash)
+	if err != nil {
+		return false, err
+	}
+	return hasher.Verify(hash, password)
+}
@@ -0,0 +1,92 @@
+package authentication
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type mapSecretProvider map[string]string
+
+func (p mapSecretProvider) Secret(name string) ([]byte, error) {
+	secret, ok := p[name]
+	if !ok {
+		return nil, errors.New("no secret " + name)
+	}
+	return []byte(secret), nil
+}
+
+func TestPepperedHashes(t *testing.T) {
+	provider := mapSecretProvider{
+		"password-pepper-v1": "first-pepper-0123456789",
+		"password-pepper-v2": "second-pepper-0123456789",
+	}
+	hasher := &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	first := &Pepper{Provider: provider, Name: DefaultPepperName, CurrentVersion: 1}
+	second := &Pepper{Provider: provider, Name: DefaultPepperName, CurrentVersion: 2}
+
+	hash, err := hashPassword(hasher, first, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$pepper$v=1$argon2id$") {
+		t.Fatalf("hash %s does not record the pepper version", hash)
+	}
+
+	if !IsHashSameAsUnhashedStringWithPepper(hash, "1234", second) {
+		t.Fatal("hash with an older pepper version rejected")
+	}
+	if IsHashSameAsUnhashedStringWithPepper(hash, "12345", second) {
+		t.Fatal("wrong password accepted")
+	}
+	if IsHashSameAsUnhashedString(hash, "1234") {
+		t.Fatal("peppered hash accepted without the pepper")
+	}
+
+	withoutOldVersion := &Pepper{Provider: mapSecretProvider{"password-pepper-v2": provider["password-pepper-v2"]}, Name: DefaultPepperName, CurrentVersion: 2}
+	if IsHashSameAsUnhashedStringWithPepper(hash, "1234", withoutOldVersion) {
+		t.Fatal("hash accepted without its pepper version")
+	}
+
+	dal := &DALPostgres{passwordHasher: hasher, pepper: second}
+	if !dal.passwordNeedsRehash(hash) {
+		t.Fatal("hash with an older pepper version does not need rehash")
+	}
+	unpeppered, err := hasher.Hash("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dal.passwordNeedsRehash(unpeppered) {
+		t.Fatal("hash without pepper does not need rehash")
+	}
+	current, err := dal.hashPassword("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dal.passwordNeedsRehash(current) {
+		t.Fatal("hash with the current pepper version needs rehash")
+	}
+
+	if _, err := hashPassword(hasher, &Pepper{Provider: mapSecretProvider{"password-pepper-v1": "short"}, Name: DefaultPepperName, CurrentVersion: 1}, "1234"); err == nil {
+		t.Fatal("short pepper accepted")
+	}
+}
+
+func TestParsePepper(t *testing.T) {
+	t.Setenv("AUTHENTICATION_PASSWORD_PEPPER_V3", "env-pepper-0123456789")
+
+	pepper, err := ParsePepper(`{"provider": "env", "path": "AUTHENTICATION_", "current_version": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pepper.Name != DefaultPepperName || pepper.CurrentVersion != 3 {
+		t.Fatalf("pepper = %+v", pepper)
+	}
+
+	if _, err := ParsePepper(`{"provider": "env", "path": "AUTHENTICATION_", "current_version": 4}`); err == nil {
+		t.Fatal("missing pepper version accepted")
+	}
+	if _, err := ParsePepper(`{"provider": "vault", "current_version": 1}`); err == nil {
+		t.Fatal("unknown provider accepted")
+	}
+}
@@ -0,0 +1,226 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+type refreshedSession struct {
+	Token          string
+	TokenExpiresAt time.Time
+
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+
+	EvictedSessions []uuid.UUID
+	Warning         string
+}
+
+// refreshSession issues a new access token from a refresh token, shared by LoginRefreshToken and RefreshToken.
+// With rotation enabled the refresh token is retired and replaced by a successor in the same family, and
+// presenting a retired token again revokes the whole family. A non-empty reason means the request was refused.
+func (dal *DALPostgres) refreshSession(ctx context.Context, entityID uuid.UUID, rawRefreshToken string, client clientContext) (*refreshedSession, string, error) {
+	refreshTokenRandomId, _, err := dal.verifyToken(rawRefreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query1 := `SELECT id, family_id, client_type, audience, active, rotated_at, ip_address, device_fingerprint, expires_at FROM entity_refresh_tokens 
+				WHERE entity_id = $1 AND token_random_id = $2 AND token_hash = $3 AND expires_at > current_epoch();`
+	rows, err := dal.db.Query(ctx, query1, entityID, refreshTokenRandomId, HashToken(rawRefreshToken))
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	refreshTokenIdString := ""
+	familyID := uuid.Nil
+	var clientType ClientType
+	var requestedAudience *string
+	refreshTokenActive := false
+	var rotatedAt *int64
+	var boundIPAddress, boundDeviceFingerprint *string
+	var refreshTokenExpiresAt int64
+	for rows.Next() {
+		err := rows.Scan(&refreshTokenIdString, &familyID, &clientType, &requestedAudience, &refreshTokenActive, &rotatedAt, &boundIPAddress, &boundDeviceFingerprint, &refreshTokenExpiresAt)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	refreshTokenId, err := uuid.Parse(refreshTokenIdString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !refreshTokenActive {
+		if rotatedAt != nil {
+			return dal.refuseReusedRefreshToken(ctx, entityID, familyID, client)
+		}
+		return nil, "Refresh token revoked", nil
+	}
+
+	// Sessions keep the audience they were opened for, as long as the DAL still issues tokens for it.
+	audience, ok := dal.tokenAudience, true
+	if requestedAudience != nil {
+		audience, ok = dal.issuedAudience(*requestedAudience)
+	}
+	if !ok {
+		return nil, reasonUnsupportedAudience, nil
+	}
+
+	mismatch := dal.deviceBinding.deviceMismatch(boundIPAddress, boundDeviceFingerprint, client)
+	if mismatch != "" && dal.deviceBinding.Mode == DeviceBindingEnforce {
+		return dal.refuseDeviceMismatch(ctx, entityID, familyID, mismatch, client)
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	session := &refreshedSession{
+		RefreshToken:          rawRefreshToken,
+		RefreshTokenExpiresAt: time.Unix(refreshTokenExpiresAt, 0).UTC(),
+	}
+
+	if mismatch != "" {
+		err = dal.recordSecurityEvent(ctx, tx, entityID, SecurityEventDeviceMismatch, mismatch+", family_id="+familyID.String()+", mode=warn", client)
+		if err != nil {
+			return nil, "", err
+		}
+		session.Warning = "Refresh token used from another device: " + mismatch
+	}
+
+	usageCount := 0
+	query2 := `UPDATE entity_refresh_tokens SET usage_count = usage_count + 1, last_used_at = current_epoch() WHERE id = $1 RETURNING usage_count;`
+	err = tx.QueryRow(ctx, query2, refreshTokenId).Scan(&usageCount)
+	if err != nil {
+		return nil, "", err
+	}
+
+	evictedSessions, rejected, err := dal.enforceSessionLimit(ctx, tx, entityID, familyID, client)
+	if err != nil {
+		return nil, "", err
+	}
+	if rejected {
+		return nil, reasonTooManySessions, nil
+	}
+	session.EvictedSessions = evictedSessions
+
+	lifetime := dal.tokenLifetime(clientType, audience)
+
+	// The session stays bound to the device and subnet it was issued to, even when a mismatch was only warned about.
+	successorClient := client
+	if boundIPAddress != nil {
+		successorClient.IPAddress = boundIPAddress
+	}
+	if boundDeviceFingerprint != nil {
+		successorClient.DeviceFingerprint = boundDeviceFingerprint
+	}
+
+	sessionID := refreshTokenId
+	if dal.rotateRefreshTokens {
+		sessionID, session.RefreshToken, session.RefreshTokenExpiresAt, err = dal.rotateRefreshToken(ctx, tx, entityID, refreshTokenId, familyID, clientType, requestedAudience, audience, usageCount, lifetime, successorClient)
+		if errors.Is(err, errRefreshTokenReused) {
+			// Lost a race against another refresh with the same token.
+			if err = tx.Rollback(ctx); err != nil {
+				return nil, "", err
+			}
+			return dal.refuseReusedRefreshToken(ctx, entityID, familyID, client)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	randomTokenId, err := GetRandomAlphanumericString(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session.TokenExpiresAt = time.Now().UTC().Add(lifetime.AccessTokenTTL)
+	session.Token, err = dal.generateAccessToken(ctx, tx, entityID, sessionID, randomTokenId, audience, session.TokenExpiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query3 := `INSERT INTO entity_tokens (entity_id, token_hash, token_random_id, refresh_token_id, ip_address, user_agent, device_fingerprint, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+	_, err = tx.Exec(ctx, query3, entityID, HashToken(session.Token), randomTokenId, sessionID, client.IPAddress, client.UserAgent, client.DeviceFingerprint, session.TokenExpiresAt.Unix())
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, "", err
+	}
+
+	return session, "", nil
+}
+
+// rotateRefreshToken retires refreshTokenID and inserts its successor for the client presenting it,
+// returning the successor's id, token and expiry.
+func (dal *DALPostgres) rotateRefreshToken(ctx context.Context, tx pgx.Tx, entityID uuid.UUID, refreshTokenID uuid.UUID, familyID uuid.UUID, clientType ClientType, requestedAudience *string, audience []string, usageCount int, lifetime TokenLifetime, client clientContext) (uuid.UUID, string, time.Time, error) {
+	query1 := `UPDATE entity_refresh_tokens SET active = false, rotated_at = current_epoch() WHERE id = $1 AND active = true;`
+	tag, err := tx.Exec(ctx, query1, refreshTokenID)
+	if err != nil {
+		return uuid.Nil, "", time.Time{}, err
+	}
+	if tag.RowsAffected() != 1 {
+		return uuid.Nil, "", time.Time{}, errRefreshTokenReused
+	}
+
+	randomRefreshTokenId, err := GetRandomAlphanumericString(32)
+	if err != nil {
+		return uuid.Nil, "", time.Time{}, err
+	}
+
+	refreshTokenExpiresAt := time.Now().UTC().Add(lifetime.RefreshTokenTTL)
+	refreshToken, err := dal.generateRefreshToken(entityID, randomRefreshTokenId, audience, refreshTokenExpiresAt)
+	if err != nil {
+		return uuid.Nil, "", time.Time{}, err
+	}
+
+	var newRefreshTokenID uuid.UUID
+	// The successor carries on the session's usage so ListSessions reflects the whole session.
+	query2 := `INSERT INTO entity_refresh_tokens (entity_id, token_hash, token_random_id, client_type, audience, family_id, parent_id, ip_address, user_agent, device_fingerprint, usage_count, last_used_at, expires_at) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, current_epoch(), $12) RETURNING id;`
+	err = tx.QueryRow(ctx, query2, entityID, HashToken(refreshToken), randomRefreshTokenId, clientType, requestedAudience, familyID, refreshTokenID, client.IPAddress, client.UserAgent, client.DeviceFingerprint, usageCount, refreshTokenExpiresAt.Unix()).Scan(&newRefreshTokenID)
+	if err != nil {
+		return uuid.Nil, "", time.Time{}, err
+	}
+
+	return newRefreshTokenID, refreshToken, refreshTokenExpiresAt, nil
+}
+
+// refuseReusedRefreshToken revokes every refresh and access token in the family and records a security event.
+func (dal *DALPostgres) refuseReusedRefreshToken(ctx context.Context, entityID uuid.UUID, familyID uuid.UUID, client clientContext) (*refreshedSession, string, error) {
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	err = revokeSessionFamily(ctx, tx, familyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = dal.recordSecurityEvent(ctx, tx, entityID, SecurityEventRefreshTokenReuse, "family_id="+familyID.String(), client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, "", err
+	}
+
+	return nil, "Refresh token reuse detected", nil
+}
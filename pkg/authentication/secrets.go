@@ -0,0 +1,150 @@
+package authentication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SecretProvider supplies secrets kept outside the database, such as password peppers.
+type SecretProvider interface {
+	Secret(name string) ([]byte, error)
+}
+
+const minSecretLength = 16
+
+// versionedSecret reads version of a secret as <name>-v<version>, e.g. password-pepper-v2.
+func versionedSecret(provider SecretProvider, name string, version int) ([]byte, error) {
+	secret, err := provider.Secret(name + "-v" + strconv.Itoa(version))
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("%s version %d is shorter than %d bytes", name, version, minSecretLength)
+	}
+	return secret, nil
+}
+
+// parseVersionedSecretConfig reads the configuration shared by peppers and encryption keys, for example:
+//
+//	{"provider": "kubernetes", "path": "/var/run/secrets/authentication", "name": "password-pepper", "current_version": 2}
+//
+// The provider is "env" (path is then the variable prefix), "file" or "kubernetes".
+func parseVersionedSecretConfig(config string, defaultName string) (SecretProvider, string, int, error) {
+	var raw struct {
+		Provider       string `json:"provider"`
+		Path           string `json:"path"`
+		Name           string `json:"name"`
+		CurrentVersion int    `json:"current_version"`
+	}
+	if err := json.Unmarshal([]byte(config), &raw); err != nil {
+		return nil, "", 0, err
+	}
+
+	name := raw.Name
+	if name == "" {
+		name = defaultName
+	}
+	if raw.CurrentVersion <= 0 {
+		return nil, "", 0, fmt.Errorf("%s version must be positive: %d", name, raw.CurrentVersion)
+	}
+
+	var provider SecretProvider
+	switch raw.Provider {
+	case "env":
+		provider = EnvSecretProvider{Prefix: raw.Path}
+	case "file":
+		provider = FileSecretProvider{Dir: raw.Path}
+	case "kubernetes":
+		provider = NewKubernetesSecretProvider(raw.Path)
+	default:
+		return nil, "", 0, fmt.Errorf("unsupported secret provider: %q", raw.Provider)
+	}
+	return provider, name, raw.CurrentVersion, nil
+}
+
+// EnvSecretProvider reads secrets from environment variables. The variable for "password-pepper-v1" with
+// prefix "AUTHENTICATION_" is AUTHENTICATION_PASSWORD_PEPPER_V1.
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+func (p EnvSecretProvider) Secret(name string) ([]byte, error) {
+	variable := p.Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	value, ok := os.LookupEnv(variable)
+	if !ok || value == "" {
+		return nil, fmt.Errorf("secret %s is not set in %s", name, variable)
+	}
+	return []byte(value), nil
+}
+
+// FileSecretProvider reads each secret from a file named after it in Dir, e.g. Docker secrets in /run/secrets.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p FileSecretProvider) Secret(name string) ([]byte, error) {
+	return readSecretFile(p.Dir, name)
+}
+
+// KubernetesSecretProvider reads a Secret mounted as a volume, one file per key. Values are cached until
+// Kubernetes updates the Secret, which it does by pointing the mount's ..data symlink at a new directory.
+type KubernetesSecretProvider struct {
+	mountPath string
+
+	mu      sync.Mutex
+	version string
+	cache   map[string][]byte
+}
+
+func NewKubernetesSecretProvider(mountPath string) *KubernetesSecretProvider {
+	return &KubernetesSecretProvider{mountPath: mountPath, cache: make(map[string][]byte)}
+}
+
+func (p *KubernetesSecretProvider) Secret(name string) ([]byte, error) {
+	// Mounts with subPath have no ..data symlink and are never updated, so they are read every time.
+	version, err := os.Readlink(filepath.Join(p.mountPath, "..data"))
+	if err != nil {
+		return readSecretFile(p.mountPath, name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if version != p.version {
+		p.version = version
+		p.cache = make(map[string][]byte)
+	}
+	if secret, ok := p.cache[name]; ok {
+		return secret, nil
+	}
+
+	secret, err := readSecretFile(p.mountPath, name)
+	if err != nil {
+		return nil, err
+	}
+	p.cache[name] = secret
+	return secret, nil
+}
+
+func readSecretFile(dir string, name string) ([]byte, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid secret name: %q", name)
+	}
+
+	secret, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	// Secrets written with echo or an editor end in a newline that is not part of the value.
+	secret = bytes.TrimRight(secret, "\r\n")
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret %s is empty", name)
+	}
+	return secret, nil
+}
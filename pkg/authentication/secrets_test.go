@@ -0,0 +1,67 @@
+package authentication
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "password-pepper-v1"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := FileSecretProvider{Dir: dir}
+	secret, err := provider.Secret("password-pepper-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "secret" {
+		t.Fatalf("secret = %q", secret)
+	}
+
+	for _, name := range []string{"", "../password-pepper-v1", "..data", "missing"} {
+		if _, err := provider.Secret(name); err == nil {
+			t.Errorf("secret %q read", name)
+		}
+	}
+}
+
+func TestKubernetesSecretProviderFollowsUpdates(t *testing.T) {
+	mount := t.TempDir()
+	writeVersion := func(version string, value string) {
+		if err := os.MkdirAll(filepath.Join(mount, version), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(mount, version, "password-pepper-v1"), []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(filepath.Join(mount, "..data"))
+		if err := os.Symlink(version, filepath.Join(mount, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeVersion("..2024_01_01", "first")
+	if err := os.Symlink(filepath.Join("..data", "password-pepper-v1"), filepath.Join(mount, "password-pepper-v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewKubernetesSecretProvider(mount)
+	secret, err := provider.Secret("password-pepper-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "first" {
+		t.Fatalf("secret = %q", secret)
+	}
+
+	writeVersion("..2024_02_01", "second")
+	secret, err = provider.Secret("password-pepper-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "second" {
+		t.Fatalf("secret after update = %q", secret)
+	}
+}
@@ -0,0 +1,29 @@
+package authentication
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventSessionEvicted    = "session_evicted"
+	SecurityEventDeviceMismatch    = "device_mismatch"
+	SecurityEventLoginLocked       = "login_locked"
+	SecurityEventLoginUnlocked     = "login_unlocked"
+	SecurityEventTOTPEnabled       = "totp_enabled"
+	SecurityEventTOTPDisabled      = "totp_disabled"
+)
+
+type clientContext struct {
+	IPAddress         *string
+	UserAgent         *string
+	DeviceFingerprint *string
+}
+
+func (dal *DALPostgres) recordSecurityEvent(ctx context.Context, db dbtx, entityID uuid.UUID, eventType string, details string, client clientContext) error {
+	query := `INSERT INTO entity_security_events (entity_id, event_type, details, ip_address, user_agent, device_fingerprint) VALUES ($1, $2, $3, $4, $5, $6);`
+	_, err := db.Exec(ctx, query, entityID, eventType, details, client.IPAddress, client.UserAgent, client.DeviceFingerprint)
+	return err
+}
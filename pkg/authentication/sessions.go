@@ -0,0 +1,255 @@
+package authentication
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSessionsPageSize = 20
+	maxSessionsPageSize     = 100
+)
+
+// A session is a refresh token family: with rotation enabled it is the family's single active refresh token,
+// and it dates from the family's first token.
+func (dal *DALPostgres) ListSessions(ctx context.Context, req *ListSessionsRequest) (*ListSessionsResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSessionsPageSize
+	}
+	if limit > maxSessionsPageSize {
+		limit = maxSessionsPageSize
+	}
+	if req.Offset < 0 {
+		return &ListSessionsResponse{Valid: false, Error: "Invalid offset"}, nil
+	}
+
+	currentFamilyID := uuid.Nil
+	if req.Token != "" {
+		familyID, found, err := dal.sessionFamilyOfToken(ctx, req.Entity, req.Token)
+		if err != nil {
+			return &ListSessionsResponse{Valid: false, Error: err.Error()}, err
+		}
+		if !found {
+			return &ListSessionsResponse{Valid: false, Error: "Invalid token"}, nil
+		}
+		currentFamilyID = familyID
+	}
+
+	query1 := `SELECT COUNT(*) FROM entity_refresh_tokens WHERE entity_id = $1 AND active = true AND expires_at > current_epoch();`
+	total := 0
+	err := dal.db.QueryRow(ctx, query1, req.Entity).Scan(&total)
+	if err != nil {
+		return &ListSessionsResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	query2 := `SELECT ert.id, ert.family_id, ert.client_type, ert.ip_address, ert.user_agent, ert.device_fingerprint,
+				(SELECT MIN(f.created_at) FROM entity_refresh_tokens f WHERE f.family_id = ert.family_id), ert.last_used_at, ert.expires_at
+				FROM entity_refresh_tokens ert
+				WHERE ert.entity_id = $1 AND ert.active = true AND ert.expires_at > current_epoch()
+				ORDER BY COALESCE(ert.last_used_at, ert.created_at) DESC, ert.id
+				LIMIT $2 OFFSET $3;`
+	rows, err := dal.db.Query(ctx, query2, req.Entity, limit, req.Offset)
+	if err != nil {
+		return &ListSessionsResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*EntitySession, 0)
+	for rows.Next() {
+		var session EntitySession
+		var familyID uuid.UUID
+		err := rows.Scan(&session.ID, &familyID, &session.ClientType, &session.IPAddress, &session.UserAgent, &session.DeviceFingerprint, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return &ListSessionsResponse{Valid: false, Error: err.Error()}, err
+		}
+		session.Current = currentFamilyID != uuid.Nil && familyID == currentFamilyID
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return &ListSessionsResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &ListSessionsResponse{
+		Sessions: sessions,
+		Total:    total,
+		Limit:    limit,
+		Offset:   req.Offset,
+		Valid:    true,
+		Error:    "",
+	}, nil
+}
+
+// sessionFamilyOfToken resolves a valid access or refresh token of entity to its refresh token family.
+func (dal *DALPostgres) sessionFamilyOfToken(ctx context.Context, entityID uuid.UUID, token string) (uuid.UUID, bool, error) {
+	tokenRandomId, _, err := dal.verifyToken(token)
+	if err != nil {
+		return uuid.Nil, false, nil
+	}
+
+	query1 := `SELECT ert.family_id FROM entity_tokens et
+				JOIN entity_refresh_tokens ert ON et.refresh_token_id = ert.id
+				WHERE et.entity_id = $1 AND et.token_random_id = $2 AND et.token_hash = $3 AND et.active = true
+				UNION
+				SELECT family_id FROM entity_refresh_tokens
+				WHERE entity_id = $1 AND token_random_id = $2 AND token_hash = $3 AND active = true;`
+	rows, err := dal.db.Query(ctx, query1, entityID, tokenRandomId, HashToken(token))
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	defer rows.Close()
+
+	familyID := uuid.Nil
+	for rows.Next() {
+		err := rows.Scan(&familyID)
+		if err != nil {
+			return uuid.Nil, false, err
+		}
+	}
+
+	return familyID, familyID != uuid.Nil, nil
+}
+
+// RevokeSession signs out a session by its id as returned by ListSessions. The whole refresh token family
+// is revoked, together with every access token issued from it.
+func (dal *DALPostgres) RevokeSession(ctx context.Context, req *RevokeSessionRequest) (*RevokeSessionResponse, error) {
+	query1 := `SELECT family_id FROM entity_refresh_tokens WHERE id = $1 AND entity_id = $2 AND revoked_at IS NULL;`
+
+	rows, err := dal.db.Query(ctx, query1, req.Session, req.Entity)
+	if err != nil {
+		return &RevokeSessionResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer rows.Close()
+
+	familyID := uuid.Nil
+	for rows.Next() {
+		err := rows.Scan(&familyID)
+		if err != nil {
+			return &RevokeSessionResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	if familyID == uuid.Nil {
+		return &RevokeSessionResponse{Valid: false, Error: "Session not found"}, nil
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &RevokeSessionResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = revokeSessionFamily(ctx, tx, familyID)
+	if err != nil {
+		return &RevokeSessionResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &RevokeSessionResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &RevokeSessionResponse{
+		Entity:  req.Entity,
+		Session: req.Session,
+		Valid:   true,
+		Error:   "",
+	}, nil
+}
+
+// revokeSessionFamily revokes every refresh token in the family and every access token issued from them.
+func revokeSessionFamily(ctx context.Context, db dbtx, familyID uuid.UUID) error {
+	query1 := `UPDATE entity_tokens SET active = false, revoked_at = current_epoch() 
+				WHERE active = true AND refresh_token_id IN (SELECT id FROM entity_refresh_tokens WHERE family_id = $1);`
+	_, err := db.Exec(ctx, query1, familyID)
+	if err != nil {
+		return err
+	}
+
+	query2 := `UPDATE entity_refresh_tokens SET active = false, revoked_at = current_epoch() WHERE family_id = $1 AND revoked_at IS NULL;`
+	_, err = db.Exec(ctx, query2, familyID)
+	return err
+}
+
+type SessionLimitPolicy string
+
+const (
+	// SessionLimitReject refuses new sessions while the entity is at its limit.
+	SessionLimitReject SessionLimitPolicy = "reject"
+	// SessionLimitEvictLeastRecentlyUsed revokes the sessions used least recently to make room.
+	SessionLimitEvictLeastRecentlyUsed SessionLimitPolicy = "evict_lru"
+)
+
+func (p SessionLimitPolicy) IsValid() bool {
+	switch p {
+	case "", SessionLimitReject, SessionLimitEvictLeastRecentlyUsed:
+		return true
+	default:
+		return false
+	}
+}
+
+const reasonTooManySessions = "Too many active sessions"
+
+// enforceSessionLimit makes room for one session of entityID, either a new one (currentFamilyID is uuid.Nil)
+// or the one being refreshed. It returns the evicted sessions, or rejected if the policy refuses the session.
+func (dal *DALPostgres) enforceSessionLimit(ctx context.Context, tx dbtx, entityID uuid.UUID, currentFamilyID uuid.UUID, client clientContext) ([]uuid.UUID, bool, error) {
+	if dal.maxActiveSessions <= 0 {
+		return nil, false, nil
+	}
+
+	// Serializes concurrent logins of the same entity so they can't both squeeze under the limit.
+	query1 := `SELECT id FROM entities WHERE id = $1 FOR UPDATE;`
+	_, err := tx.Exec(ctx, query1, entityID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query2 := `SELECT id, family_id FROM entity_refresh_tokens
+				WHERE entity_id = $1 AND family_id <> $2 AND active = true AND expires_at > current_epoch()
+				ORDER BY COALESCE(last_used_at, created_at), created_at;`
+	rows, err := tx.Query(ctx, query2, entityID, currentFamilyID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sessionIDs := make([]uuid.UUID, 0)
+	familyIDs := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var sessionID, familyID uuid.UUID
+		err := rows.Scan(&sessionID, &familyID)
+		if err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+		familyIDs = append(familyIDs, familyID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	excess := len(sessionIDs) + 1 - dal.maxActiveSessions
+	if excess <= 0 {
+		return nil, false, nil
+	}
+
+	if dal.sessionLimitPolicy != SessionLimitEvictLeastRecentlyUsed {
+		return nil, true, nil
+	}
+
+	for i := 0; i < excess; i++ {
+		err = revokeSessionFamily(ctx, tx, familyIDs[i])
+		if err != nil {
+			return nil, false, err
+		}
+
+		err = dal.recordSecurityEvent(ctx, tx, entityID, SecurityEventSessionEvicted, "session_id="+sessionIDs[i].String(), client)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return sessionIDs[:excess], false, nil
+}
@@ -0,0 +1,243 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signer signs tokens with a private key and resolves the public keys needed to verify them.
+type Signer interface {
+	KeyResolver
+	KeyID() string
+	Sign(claims jwt.Claims) (string, error)
+	// VerificationKeys lists every public key that tokens may currently be signed with.
+	VerificationKeys() []*VerificationKey
+}
+
+// KeyResolver returns the public key a token was signed with, selected by the token's kid header.
+type KeyResolver interface {
+	VerificationKey(kid string) (*VerificationKey, error)
+}
+
+type VerificationKey struct {
+	KeyID     string
+	Method    jwt.SigningMethod
+	PublicKey crypto.PublicKey
+}
+
+type AsymmetricSigner struct {
+	keyID      string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+}
+
+func NewSigner(keyID string, privateKey crypto.Signer) (*AsymmetricSigner, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("signing key id is required")
+	}
+
+	method, err := signingMethodForKey(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &AsymmetricSigner{
+		keyID:      keyID,
+		method:     method,
+		privateKey: privateKey,
+	}, nil
+}
+
+// NewSignerFromPEM accepts PKCS#8, PKCS#1 (RSA) and SEC 1 (EC) encoded private keys.
+func NewSignerFromPEM(keyID string, pemBytes []byte) (*AsymmetricSigner, error) {
+	privateKey, err := ParsePrivateKeyPEM(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(keyID, privateKey)
+}
+
+func (s *AsymmetricSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *AsymmetricSigner) Method() jwt.SigningMethod {
+	return s.method
+}
+
+func (s *AsymmetricSigner) PublicKey() crypto.PublicKey {
+	return s.privateKey.Public()
+}
+
+func (s *AsymmetricSigner) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.privateKey)
+}
+
+func (s *AsymmetricSigner) VerificationKey(kid string) (*VerificationKey, error) {
+	if kid != s.keyID {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return &VerificationKey{KeyID: s.keyID, Method: s.method, PublicKey: s.PublicKey()}, nil
+}
+
+func (s *AsymmetricSigner) VerificationKeys() []*VerificationKey {
+	return []*VerificationKey{{KeyID: s.keyID, Method: s.method, PublicKey: s.PublicKey()}}
+}
+
+// StaticKeyRing signs with one active key and keeps verifying and publishing recently retired keys,
+// so tokens issued before a manual key swap stay valid until they expire.
+type StaticKeyRing struct {
+	active   *AsymmetricSigner
+	previous map[string]*VerificationKey
+}
+
+func NewStaticKeyRing(active *AsymmetricSigner, previous ...*VerificationKey) *StaticKeyRing {
+	ring := &StaticKeyRing{active: active, previous: make(map[string]*VerificationKey, len(previous))}
+	for _, key := range previous {
+		ring.previous[key.KeyID] = key
+	}
+	return ring
+}
+
+func (r *StaticKeyRing) KeyID() string {
+	return r.active.KeyID()
+}
+
+func (r *StaticKeyRing) Sign(claims jwt.Claims) (string, error) {
+	return r.active.Sign(claims)
+}
+
+func (r *StaticKeyRing) VerificationKey(kid string) (*VerificationKey, error) {
+	if key, ok := r.previous[kid]; ok {
+		return key, nil
+	}
+	return r.active.VerificationKey(kid)
+}
+
+func (r *StaticKeyRing) VerificationKeys() []*VerificationKey {
+	keys := r.active.VerificationKeys()
+	for _, key := range r.previous {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// KeySet is a KeyResolver for services that only verify tokens and hold public keys.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]*VerificationKey
+}
+
+func NewKeySet(keys ...*VerificationKey) *KeySet {
+	ks := &KeySet{keys: make(map[string]*VerificationKey, len(keys))}
+	for _, key := range keys {
+		ks.keys[key.KeyID] = key
+	}
+	return ks
+}
+
+func (ks *KeySet) Add(keyID string, publicKey crypto.PublicKey) error {
+	method, err := signingMethodForKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[keyID] = &VerificationKey{KeyID: keyID, Method: method, PublicKey: publicKey}
+	return nil
+}
+
+func (ks *KeySet) AddPEM(keyID string, pemBytes []byte) error {
+	publicKey, err := ParsePublicKeyPEM(pemBytes)
+	if err != nil {
+		return err
+	}
+	return ks.Add(keyID, publicKey)
+}
+
+func (ks *KeySet) VerificationKey(kid string) (*VerificationKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return key, nil
+}
+
+func ParsePrivateKeyPEM(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+func ParsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+func signingMethodForKey(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA curve: %s", key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %T", publicKey)
+	}
+}
@@ -0,0 +1,228 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T) *AsymmetricSigner {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewSigner("test-key", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+var testSigningKeyEncryption = EncryptionKeys{
+	Provider:       mapSecretProvider{"signing-key-encryption-key-v1": "signing-key-secret-0123456789"},
+	Name:           DefaultSigningKeyEncryptionKeyName,
+	CurrentVersion: 1,
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"rsa", rsaKey, "RS256"},
+		{"ecdsa", ecKey, "ES256"},
+		{"ed25519", edKey, "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewSigner(tt.name+"-key", tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signer.Method().Alg() != tt.alg {
+				t.Fatalf("expected %s, got %s", tt.alg, signer.Method().Alg())
+			}
+
+			now := time.Now().UTC()
+			token, err := GenerateJWT("https://test.com", "subject", []string{"test"}, now.Add(time.Minute), now, now, "jti", signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keys := NewKeySet()
+			if err := keys.Add(signer.KeyID(), signer.PublicKey()); err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := VerifyJWT(token, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "subject" || claims.ID != "jti" {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyJWTSelectsKeyByKid(t *testing.T) {
+	first := newTestSigner(t)
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewSigner("other-key", otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	token, err := GenerateJWT("https://test.com", "subject", nil, now.Add(time.Minute), now, now, "jti", second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyJWT(token, first); err == nil {
+		t.Fatal("expected verification with unknown kid to fail")
+	}
+
+	// A key set that maps the kid to the wrong public key must reject the signature.
+	mismatched := NewKeySet(&VerificationKey{KeyID: "other-key", Method: first.Method(), PublicKey: first.PublicKey()})
+	if _, err := VerifyJWT(token, mismatched); err == nil {
+		t.Fatal("expected verification with mismatched key to fail")
+	}
+
+	if _, err := VerifyJWT(token, second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSignerFromPEM(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewSignerFromPEM("pem-key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Method().Alg() != "ES384" {
+		t.Fatalf("expected ES384, got %s", signer.Method().Alg())
+	}
+}
+
+func TestStaticKeyRingPublishesPreviousKeys(t *testing.T) {
+	previous := newTestSigner(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := NewSigner("active-key", ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring := NewStaticKeyRing(active, previous.VerificationKeys()...)
+
+	now := time.Now().UTC()
+	token, err := GenerateJWT("https://test.com", "subject", nil, now.Add(time.Minute), now, now, "jti", previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyJWT(token, ring); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := NewJWKS(ring.VerificationKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+	}
+	for _, jwk := range jwks.Keys {
+		switch jwk.KeyID {
+		case "active-key":
+			if jwk.KeyType != "EC" || jwk.Curve != "P-256" || len(jwk.X) != 43 || len(jwk.Y) != 43 {
+				t.Fatalf("unexpected EC JWK: %+v", jwk)
+			}
+		case "test-key":
+			if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.Algorithm != "EdDSA" {
+				t.Fatalf("unexpected OKP JWK: %+v", jwk)
+			}
+		default:
+			t.Fatalf("unexpected kid: %s", jwk.KeyID)
+		}
+	}
+}
+
+func TestKeyRingSealsPrivateKeys(t *testing.T) {
+	privateKey, err := generateSigningKey("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKeyPEM, _, err := encodeSigningKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring := &KeyRing{encryptionKeys: testSigningKeyEncryption}
+	sealed, err := ring.encryptionKeys.seal([]byte(privateKeyPEM), []byte("kid-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := ring.openPrivateKey("kid-1", sealed)
+	if err != nil || string(opened) != privateKeyPEM {
+		t.Fatal("sealed private key did not open")
+	}
+	if _, err := ring.openPrivateKey("kid-2", sealed); err == nil {
+		t.Fatal("sealed private key opened under another kid")
+	}
+
+	// Keys stored before sealing stay readable until they are rotated out.
+	opened, err = ring.openPrivateKey("kid-1", privateKeyPEM)
+	if err != nil || string(opened) != privateKeyPEM {
+		t.Fatal("plaintext private key not read")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// Must match encode(sha256(convert_to(token, 'UTF8')), 'hex') used by the token hashing migration.
+	if HashToken("abc") != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatal("unexpected token digest")
+	}
+}
@@ -0,0 +1,138 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type TokenFormat string
+
+const (
+	// TokenFormatJWT issues signed JWTs that consumers can verify offline.
+	TokenFormatJWT TokenFormat = "jwt"
+	// TokenFormatOpaque issues random reference tokens that only this service can resolve.
+	TokenFormatOpaque TokenFormat = "opaque"
+)
+
+func (f TokenFormat) IsValid() bool {
+	switch f {
+	case TokenFormatJWT, TokenFormatOpaque:
+		return true
+	default:
+		return false
+	}
+}
+
+// Opaque tokens are "<token_random_id>.<secret>". A JWT always has two dots, so the formats can't be confused.
+const opaqueTokenSecretLength = 32
+
+func newOpaqueToken(tokenID string) (string, error) {
+	secret, err := GetRandomAlphanumericString(opaqueTokenSecretLength)
+	if err != nil {
+		return "", err
+	}
+	return tokenID + "." + secret, nil
+}
+
+func parseOpaqueToken(token string) (string, bool) {
+	tokenID, secret, found := strings.Cut(token, ".")
+	if !found || tokenID == "" || len(secret) != opaqueTokenSecretLength || strings.Contains(secret, ".") {
+		return "", false
+	}
+	return tokenID, true
+}
+
+// generateAccessToken signs an access token for the session sessionID, carrying the entity's
+// basic profile claims plus anything added by the configured ClaimsEnricher.
+func (dal *DALPostgres) generateAccessToken(ctx context.Context, db dbtx, entityID uuid.UUID, sessionID uuid.UUID, tokenID string, audience []string, expiresAt time.Time) (string, error) {
+	if dal.tokenFormat == TokenFormatOpaque {
+		return newOpaqueToken(tokenID)
+	}
+
+	emailVerified := false
+	publicIdentifier := ""
+	query := `SELECT COALESCE(is_verified, false), public_identifier FROM entities WHERE id = $1;`
+	err := db.QueryRow(ctx, query, entityID).Scan(&emailVerified, &publicIdentifier)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims := &AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    dal.tokenIssuer,
+			Subject:   entityID.String(),
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        tokenID,
+		},
+		EmailVerified:    &emailVerified,
+		PublicIdentifier: publicIdentifier,
+		SessionID:        sessionID.String(),
+	}
+
+	if dal.claimsEnricher != nil {
+		if err := dal.claimsEnricher(ctx, entityID, claims); err != nil {
+			return "", err
+		}
+	}
+
+	return GenerateJWTWithClaims(claims, dal.signer)
+}
+
+func (dal *DALPostgres) generateRefreshToken(entityID uuid.UUID, tokenID string, audience []string, expiresAt time.Time) (string, error) {
+	if dal.tokenFormat == TokenFormatOpaque {
+		return newOpaqueToken(tokenID)
+	}
+
+	now := time.Now().UTC()
+	return GenerateJWT(dal.tokenIssuer, entityID.String(), audience, expiresAt, now, now, tokenID, dal.signer)
+}
+
+// verifyToken returns the token_random_id of a token issued in either format. JWTs are also checked
+// against the DAL's TokenValidator and their claims returned; opaque tokens are only valid once found in the database.
+func (dal *DALPostgres) verifyToken(token string) (string, *AccessTokenClaims, error) {
+	if tokenID, ok := parseOpaqueToken(token); ok {
+		return tokenID, nil, nil
+	}
+
+	claims, err := dal.validator.ValidateRefreshToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+	// MaxAge only limits access tokens, which are the ones carrying a session id.
+	if claims.SessionID != "" {
+		if err := dal.validator.checkMaxAge(claims); err != nil {
+			return "", nil, err
+		}
+	}
+	if claims.ID == "" {
+		return "", nil, fmt.Errorf("token has no jti")
+	}
+
+	return claims.ID, claims, nil
+}
+
+// tokenRandomID returns the token_random_id of a token issued in either format. Expired JWTs are accepted
+// so they can still be revoked.
+func (dal *DALPostgres) tokenRandomID(token string) (string, error) {
+	if tokenID, ok := parseOpaqueToken(token); ok {
+		return tokenID, nil
+	}
+
+	claims, err := dal.validator.ValidateIgnoringExpiry(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.ID == "" {
+		return "", fmt.Errorf("token has no jti")
+	}
+	return claims.ID, nil
+}
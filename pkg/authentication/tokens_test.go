@@ -0,0 +1,33 @@
+package authentication
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpaqueTokenFormat(t *testing.T) {
+	token, err := newOpaqueToken("tokenRandomId")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenID, ok := parseOpaqueToken(token)
+	if !ok || tokenID != "tokenRandomId" {
+		t.Fatalf("failed to parse opaque token %q", token)
+	}
+
+	signer := newTestSigner(t)
+	now := time.Now().UTC()
+	jwtToken, err := GenerateJWT("https://test.com", "subject", nil, now.Add(time.Minute), now, now, "jti", signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := parseOpaqueToken(jwtToken); ok {
+		t.Fatal("a JWT must not parse as an opaque token")
+	}
+	if _, ok := parseOpaqueToken(strings.Split(token, ".")[0]); ok {
+		t.Fatal("a token without a secret must not parse as an opaque token")
+	}
+}
@@ -0,0 +1,485 @@
+package authentication
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTPPolicy follows RFC 6238 with HMAC-SHA1, which is what authenticator apps support.
+type TOTPPolicy struct {
+	// Issuer names the service in authenticator apps.
+	Issuer string `json:"issuer"`
+	Digits int    `json:"digits"`
+	// Period is the length of a time step in seconds.
+	Period int `json:"period"`
+	// Skew is how many time steps before and after the current one are accepted, for clocks that drift.
+	Skew int `json:"skew"`
+}
+
+var DefaultTOTPPolicy = TOTPPolicy{
+	Issuer: "CoreKit",
+	Digits: 6,
+	Period: 30,
+	Skew:   1,
+}
+
+// ParseTOTPPolicy reads a policy from configuration, for example:
+//
+//	{"issuer": "CoreKit", "digits": 6, "period": 30, "skew": 1}
+//
+// Anything left out keeps the value from DefaultTOTPPolicy.
+func ParseTOTPPolicy(config string) (TOTPPolicy, error) {
+	policy := DefaultTOTPPolicy
+	if err := json.Unmarshal([]byte(config), &policy); err != nil {
+		return TOTPPolicy{}, err
+	}
+
+	// Codes longer than 9 digits would overflow the 31 bit value they are taken from.
+	if policy.Digits < 6 || policy.Digits > 9 {
+		return TOTPPolicy{}, fmt.Errorf("TOTP digits must be between 6 and 9: %d", policy.Digits)
+	}
+	if policy.Period <= 0 {
+		return TOTPPolicy{}, fmt.Errorf("TOTP period must be positive: %d", policy.Period)
+	}
+	if policy.Skew < 0 {
+		return TOTPPolicy{}, fmt.Errorf("TOTP skew must not be negative: %d", policy.Skew)
+	}
+	if policy.Issuer == "" {
+		return TOTPPolicy{}, fmt.Errorf("TOTP issuer must not be empty")
+	}
+	return policy, nil
+}
+
+const totpSecretLength = 20
+
+var totpSecretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+const reasonInvalidTOTPCode = "Invalid code"
+
+func totpCode(secret []byte, step int64, digits int) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%modulus)
+}
+
+// matchStep returns the time step code belongs to, looking Skew steps around now. Steps up to lastUsedStep
+// are skipped, so a code that was accepted once is never accepted again.
+func (p TOTPPolicy) matchStep(secret []byte, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	if len(code) != p.Digits {
+		return 0, false
+	}
+
+	current := now.Unix() / int64(p.Period)
+	for step := current - int64(p.Skew); step <= current+int64(p.Skew); step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step, p.Digits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// uri is the otpauth URI authenticator apps read from a QR code.
+func (p TOTPPolicy) uri(secret []byte, account string) string {
+	values := url.Values{
+		"secret":    {totpSecretEncoding.EncodeToString(secret)},
+		"issuer":    {p.Issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {strconv.Itoa(p.Digits)},
+		"period":    {strconv.Itoa(p.Period)},
+	}
+	return "otpauth://totp/" + url.PathEscape(p.Issuer+":"+account) + "?" + values.Encode()
+}
+
+type entityTOTPMethod struct {
+	ID               uuid.UUID
+	SecretCiphertext string
+	ConfirmedAt      *int64
+	LastUsedStep     *int64
+}
+
+// entityTOTP returns the entity's active TOTP method, confirmed or not, or nil if it has none.
+func (dal *DALPostgres) entityTOTP(ctx context.Context, db dbtx, entityID uuid.UUID) (*entityTOTPMethod, error) {
+	query1 := `SELECT elmt.id, elmt.secret_ciphertext, elmt.confirmed_at, elmt.last_used_step
+				FROM entity_login_methods elm JOIN entity_login_method_totp elmt ON elm.method_id = elmt.id
+				WHERE elm.entity_id = $1 AND elm.method_type = 'entity_login_method_totp' AND elm.active = true AND elmt.active = true
+				ORDER BY elmt.created_at DESC LIMIT 1;`
+
+	rows, err := db.Query(ctx, query1, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var method *entityTOTPMethod
+	for rows.Next() {
+		method = &entityTOTPMethod{}
+		err := rows.Scan(&method.ID, &method.SecretCiphertext, &method.ConfirmedAt, &method.LastUsedStep)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+// totpAdditionalData binds a sealed secret to its entity and method.
+func totpAdditionalData(entityID uuid.UUID, methodID uuid.UUID) []byte {
+	return []byte(entityID.String() + ":" + methodID.String())
+}
+
+// checkTOTPCode verifies code and returns the time step to consume, or when the method's lock ends if it is
+// locked. Wrong codes count towards the lockout policy. It must not run inside a transaction on dal.db.
+func (dal *DALPostgres) checkTOTPCode(ctx context.Context, entityID uuid.UUID, method *entityTOTPMethod, code string, client clientContext) (int64, int64, bool, error) {
+	lockedUntil, err := dal.loginLockedUntil(ctx, dal.db, entityID, loginMethodTOTP, method.ID)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if lockedUntil > 0 {
+		return 0, lockedUntil, false, nil
+	}
+
+	secret, err := dal.totpKeys.open(method.SecretCiphertext, totpAdditionalData(entityID, method.ID))
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	lastUsedStep := int64(0)
+	if method.LastUsedStep != nil {
+		lastUsedStep = *method.LastUsedStep
+	}
+
+	step, ok := dal.totpPolicy.matchStep(secret, code, time.Now(), lastUsedStep)
+	if !ok {
+		lockedUntil, err := dal.recordFailedLogin(ctx, entityID, loginMethodTOTP, method.ID, client)
+		return 0, lockedUntil, false, err
+	}
+	return step, 0, true, nil
+}
+
+// consumeTOTPStep records step as used. It reports false if the step or a later one was used in the meantime.
+func (dal *DALPostgres) consumeTOTPStep(ctx context.Context, db dbtx, methodID uuid.UUID, step int64) (bool, error) {
+	query := `UPDATE entity_login_method_totp SET last_used_step = $2
+				WHERE id = $1 AND (last_used_step IS NULL OR last_used_step < $2);`
+	tag, err := db.Exec(ctx, query, methodID, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// EnrollTOTP creates a TOTP secret for the entity, which takes effect once ConfirmTOTP receives a code for it.
+// Enrolling again before confirming replaces the pending secret.
+func (dal *DALPostgres) EnrollTOTP(ctx context.Context, req *EnrollTOTPRequest) (*EnrollTOTPResponse, error) {
+	if dal.totpKeys == nil {
+		return &EnrollTOTPResponse{Valid: false, Error: "TOTP is not configured"}, nil
+	}
+
+	query1 := `SELECT primary_email FROM entities WHERE id = $1 AND active = true;`
+	rows, err := dal.db.Query(ctx, query1, req.Entity)
+	if err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer rows.Close()
+
+	primaryEmail := ""
+	for rows.Next() {
+		err := rows.Scan(&primaryEmail)
+		if err != nil {
+			return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	if primaryEmail == "" {
+		return &EnrollTOTPResponse{Valid: false, Error: "Not found"}, nil
+	}
+
+	existing, err := dal.entityTOTP(ctx, dal.db, req.Entity)
+	if err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: "TOTP already enabled"}, nil
+	}
+
+	secret := make([]byte, totpSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	methodID := uuid.Must(uuid.NewV7())
+	secretCiphertext, err := dal.totpKeys.seal(secret, totpAdditionalData(req.Entity, methodID))
+	if err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if existing != nil {
+		err = deactivateTOTP(ctx, tx, existing.ID)
+		if err != nil {
+			return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	query2 := `INSERT INTO entity_login_method_totp (id, secret_ciphertext) VALUES ($1, $2);`
+	_, err = tx.Exec(ctx, query2, methodID, secretCiphertext)
+	if err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	query3 := `INSERT INTO entity_login_methods (entity_id, method_id, method_type) VALUES ($1, $2, 'entity_login_method_totp');`
+	_, err = tx.Exec(ctx, query3, req.Entity, methodID)
+	if err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &EnrollTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &EnrollTOTPResponse{
+		Entity: req.Entity,
+		Secret: totpSecretEncoding.EncodeToString(secret),
+		URI:    dal.totpPolicy.uri(secret, primaryEmail),
+		Valid:  true,
+		Error:  "",
+	}, nil
+}
+
+// ConfirmTOTP enables the pending TOTP secret once the entity proves their authenticator produces its codes.
+func (dal *DALPostgres) ConfirmTOTP(ctx context.Context, req *ConfirmTOTPRequest) (*ConfirmTOTPResponse, error) {
+	if dal.totpKeys == nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: "TOTP is not configured"}, nil
+	}
+
+	method, err := dal.entityTOTP(ctx, dal.db, req.Entity)
+	if err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if method == nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: "Not found"}, nil
+	}
+	if method.ConfirmedAt != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: "TOTP already enabled"}, nil
+	}
+
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+	step, lockedUntil, ok, err := dal.checkTOTPCode(ctx, req.Entity, method, req.Code, client)
+	if err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if lockedUntil > 0 {
+		return &ConfirmTOTPResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+	}
+	if !ok {
+		return &ConfirmTOTPResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: reasonInvalidTOTPCode}, nil
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	query1 := `UPDATE entity_login_method_totp SET confirmed_at = current_epoch(), last_used_step = $2
+				WHERE id = $1 AND confirmed_at IS NULL AND active = true;`
+	tag, err := tx.Exec(ctx, query1, method.ID, step)
+	if err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return &ConfirmTOTPResponse{Valid: false, Error: "TOTP already enabled"}, nil
+	}
+
+	err = dal.resetFailedLogins(ctx, tx, req.Entity, loginMethodTOTP, method.ID)
+	if err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	err = dal.recordSecurityEvent(ctx, tx, req.Entity, SecurityEventTOTPEnabled, "", client)
+	if err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &ConfirmTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &ConfirmTOTPResponse{
+		Entity: req.Entity,
+		Valid:  true,
+		Error:  "",
+	}, nil
+}
+
+// VerifyTOTP checks a code from the entity's confirmed authenticator, e.g. as the second factor of a login.
+func (dal *DALPostgres) VerifyTOTP(ctx context.Context, req *VerifyTOTPRequest) (*VerifyTOTPResponse, error) {
+	if dal.totpKeys == nil {
+		return &VerifyTOTPResponse{Valid: false, Error: "TOTP is not configured"}, nil
+	}
+
+	method, err := dal.entityTOTP(ctx, dal.db, req.Entity)
+	if err != nil {
+		return &VerifyTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if method == nil || method.ConfirmedAt == nil {
+		return &VerifyTOTPResponse{Valid: false, Error: "TOTP not enabled"}, nil
+	}
+
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+	step, lockedUntil, ok, err := dal.checkTOTPCode(ctx, req.Entity, method, req.Code, client)
+	if err != nil {
+		return &VerifyTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if lockedUntil > 0 {
+		return &VerifyTOTPResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+	}
+	if !ok {
+		return &VerifyTOTPResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: reasonInvalidTOTPCode}, nil
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &VerifyTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	consumed, err := dal.consumeTOTPStep(ctx, tx, method.ID, step)
+	if err != nil {
+		return &VerifyTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if !consumed {
+		return &VerifyTOTPResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: reasonInvalidTOTPCode}, nil
+	}
+
+	err = dal.resetFailedLogins(ctx, tx, req.Entity, loginMethodTOTP, method.ID)
+	if err != nil {
+		return &VerifyTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &VerifyTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &VerifyTOTPResponse{
+		Entity: req.Entity,
+		Valid:  true,
+		Error:  "",
+	}, nil
+}
+
+// DisableTOTP removes the entity's TOTP method, confirmed or pending. A confirmed one needs a current code.
+func (dal *DALPostgres) DisableTOTP(ctx context.Context, req *DisableTOTPRequest) (*DisableTOTPResponse, error) {
+	if dal.totpKeys == nil {
+		return &DisableTOTPResponse{Valid: false, Error: "TOTP is not configured"}, nil
+	}
+
+	method, err := dal.entityTOTP(ctx, dal.db, req.Entity)
+	if err != nil {
+		return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	if method == nil {
+		return &DisableTOTPResponse{Valid: false, Error: "TOTP not enabled"}, nil
+	}
+
+	client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+	step := int64(0)
+	if method.ConfirmedAt != nil {
+		var lockedUntil int64
+		var ok bool
+		step, lockedUntil, ok, err = dal.checkTOTPCode(ctx, req.Entity, method, req.Code, client)
+		if err != nil {
+			return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+		}
+		if lockedUntil > 0 {
+			return &DisableTOTPResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+		}
+		if !ok {
+			return &DisableTOTPResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: reasonInvalidTOTPCode}, nil
+		}
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The code is used up like in VerifyTOTP, so an intercepted one cannot also disable TOTP.
+	if method.ConfirmedAt != nil {
+		consumed, err := dal.consumeTOTPStep(ctx, tx, method.ID, step)
+		if err != nil {
+			return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+		}
+		if !consumed {
+			return &DisableTOTPResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: reasonInvalidTOTPCode}, nil
+		}
+	}
+
+	err = deactivateTOTP(ctx, tx, method.ID)
+	if err != nil {
+		return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	if method.ConfirmedAt != nil {
+		err = dal.recordSecurityEvent(ctx, tx, req.Entity, SecurityEventTOTPDisabled, "", client)
+		if err != nil {
+			return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &DisableTOTPResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &DisableTOTPResponse{
+		Entity: req.Entity,
+		Valid:  true,
+		Error:  "",
+	}, nil
+}
+
+func deactivateTOTP(ctx context.Context, db dbtx, methodID uuid.UUID) error {
+	query1 := `UPDATE entity_login_method_totp SET active = false, deleted_at = current_epoch() WHERE id = $1;`
+	_, err := db.Exec(ctx, query1, methodID)
+	if err != nil {
+		return err
+	}
+
+	query2 := `UPDATE entity_login_methods SET active = false, deleted_at = current_epoch() WHERE method_id = $1 AND method_type = 'entity_login_method_totp';`
+	_, err = db.Exec(ctx, query2, methodID)
+	return err
+}
@@ -0,0 +1,84 @@
+package authentication
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+	}
+	for _, c := range cases {
+		if got := totpCode(secret, c.unix/30, 8); got != c.want {
+			t.Errorf("totpCode at %d = %s, want %s", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestTOTPMatchStep(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	policy := DefaultTOTPPolicy
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / 30
+
+	for _, offset := range []int64{-1, 0, 1} {
+		step, ok := policy.matchStep(secret, totpCode(secret, current+offset, 6), now, 0)
+		if !ok || step != current+offset {
+			t.Errorf("code %d steps away not accepted", offset)
+		}
+	}
+
+	if _, ok := policy.matchStep(secret, totpCode(secret, current-2, 6), now, 0); ok {
+		t.Error("code outside the drift window accepted")
+	}
+	if _, ok := policy.matchStep(secret, totpCode(secret, current, 6), now, current); ok {
+		t.Error("replayed code accepted")
+	}
+	if _, ok := policy.matchStep(secret, totpCode(secret, current+1, 6), now, current); !ok {
+		t.Error("code for a later step refused after replay protection")
+	}
+	if _, ok := policy.matchStep(secret, "", now, 0); ok {
+		t.Error("empty code accepted")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(DefaultTOTPPolicy.uri([]byte("12345678901234567890"), "1234@email.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/CoreKit:1234@email.com" {
+		t.Fatalf("uri = %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" || query.Get("issuer") != "CoreKit" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Fatalf("uri parameters = %v", query)
+	}
+}
+
+func TestParseTOTPPolicy(t *testing.T) {
+	policy, err := ParseTOTPPolicy(`{"issuer": "Test", "digits": 8}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (TOTPPolicy{Issuer: "Test", Digits: 8, Period: 30, Skew: 1}); policy != want {
+		t.Fatalf("policy = %+v, want %+v", policy, want)
+	}
+
+	for _, config := range []string{`{"period": 0}`, `{"digits": 10}`, `{"digits": 4}`, `{"skew": -1}`, `{"issuer": ""}`} {
+		if _, err := ParseTOTPPolicy(config); err == nil {
+			t.Fatalf("invalid policy %s accepted", config)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package authentication
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+func (dal *DALPostgres) UpdatePassword(ctx context.Context, req *UpdatePasswordRequest) (*UpdatePasswordResponse, error) {
+	query1 := `SELECT elmp.id, elmp.password_hash, e.primary_email, e.public_identifier
+				FROM entities e JOIN entity_login_methods elm ON e.id = elm.entity_id
+				JOIN entity_login_method_password elmp ON elm.method_id = elmp.id
+				WHERE e.active = true AND elm.active = true AND elmp.active = true AND elm.method_type = 'entity_login_method_password'
+				AND e.id = $1;`
+
+	rows, err := dal.db.Query(ctx, query1, req.Entity)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer rows.Close()
+
+	methodID := uuid.Nil
+	passwordHash := ""
+	primaryEmail := ""
+	publicIdentifier := ""
+	for rows.Next() {
+		err := rows.Scan(&methodID, &passwordHash, &primaryEmail, &publicIdentifier)
+		if err != nil {
+			return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	if methodID == uuid.Nil {
+		return &UpdatePasswordResponse{Valid: false, Error: "Not found"}, nil
+	}
+
+	lockedUntil, err := dal.loginLockedUntil(ctx, dal.db, req.Entity, loginMethodPassword, methodID)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	if lockedUntil > 0 {
+		return &UpdatePasswordResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+	}
+
+	// A stolen access token must not allow unlimited guesses at the current password either.
+	if !dal.passwordMatches(passwordHash, req.CurrentPassword) {
+		client := clientContext{IPAddress: req.IPAddress, UserAgent: req.UserAgent, DeviceFingerprint: req.DeviceFingerprint}
+		lockedUntil, err := dal.recordFailedLogin(ctx, req.Entity, loginMethodPassword, methodID, client)
+		if err != nil {
+			return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+		if lockedUntil > 0 {
+			return &UpdatePasswordResponse{ErrorCode: ErrorCodeAccountLocked, LockedUntil: lockedUntil, Valid: false, Error: reasonAccountLocked}, nil
+		}
+		return &UpdatePasswordResponse{ErrorCode: ErrorCodeInvalidCredentials, Valid: false, Error: "Incorrect password"}, nil
+	}
+
+	violations := dal.checkPasswordPolicy(req.NewPassword, primaryEmail, publicIdentifier)
+	if len(violations) > 0 {
+		return &UpdatePasswordResponse{PasswordViolations: violations, Valid: false, Error: reasonPasswordPolicy}, nil
+	}
+
+	currentFamilyID := uuid.Nil
+	if req.RevokeOtherSessions && req.Token != "" {
+		familyID, found, err := dal.sessionFamilyOfToken(ctx, req.Entity, req.Token)
+		if err != nil {
+			return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+		if !found {
+			return &UpdatePasswordResponse{Valid: false, Error: "Invalid token"}, nil
+		}
+		currentFamilyID = familyID
+	}
+
+	tx, err := dal.db.Begin(ctx)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	defer tx.Rollback(ctx)
+
+	recentlyUsed, err := dal.passwordRecentlyUsed(ctx, tx, methodID, passwordHash, req.NewPassword)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+	if recentlyUsed {
+		return &UpdatePasswordResponse{PasswordViolations: []PasswordViolation{passwordRecentlyUsedViolation(dal.passwordHistoryDepth)}, Valid: false, Error: reasonPasswordPolicy}, nil
+	}
+
+	err = dal.recordPasswordHistory(ctx, tx, methodID, passwordHash)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	err = dal.resetFailedLogins(ctx, tx, req.Entity, loginMethodPassword, methodID)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	newPasswordHash, err := dal.hashPassword(req.NewPassword)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	query2 := `UPDATE entity_login_method_password SET password_hash = $1, password_reset_token = NULL, password_reset_token_expires_at = 0 WHERE id = $2;`
+	_, err = tx.Exec(ctx, query2, newPasswordHash, methodID)
+	if err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	var revokedSessions int64
+	if req.RevokeOtherSessions {
+		// uuid.Nil matches no family, so without a current session every session is revoked.
+		query3 := `UPDATE entity_tokens SET active = false, revoked_at = current_epoch()
+					WHERE entity_id = $1 AND active = true
+					AND refresh_token_id NOT IN (SELECT id FROM entity_refresh_tokens WHERE family_id = $2);`
+		_, err = tx.Exec(ctx, query3, req.Entity, currentFamilyID)
+		if err != nil {
+			return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+
+		query4 := `SELECT COUNT(*) FROM entity_refresh_tokens WHERE entity_id = $1 AND family_id <> $2 AND active = true AND expires_at > current_epoch();`
+		err = tx.QueryRow(ctx, query4, req.Entity, currentFamilyID).Scan(&revokedSessions)
+		if err != nil {
+			return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+
+		query5 := `UPDATE entity_refresh_tokens SET active = false, revoked_at = current_epoch()
+					WHERE entity_id = $1 AND family_id <> $2 AND revoked_at IS NULL;`
+		_, err = tx.Exec(ctx, query5, req.Entity, currentFamilyID)
+		if err != nil {
+			return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return &UpdatePasswordResponse{Valid: false, Error: err.Error()}, err
+	}
+
+	return &UpdatePasswordResponse{
+		Entity:          req.Entity,
+		RevokedSessions: revokedSessions,
+		Valid:           true,
+		Error:           "",
+	}, nil
+}
@@ -2,8 +2,9 @@ package authentication
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"golang.org/x/crypto/bcrypt"
 	"math/big"
 	"time"
 
@@ -11,20 +12,33 @@ import (
 )
 
 func HashString(s string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashed), nil
+	return HashStringWithPepper(s, nil)
+}
+
+// HashStringWithPepper keys the hash with the current version of pepper, or hashes without one if it is nil.
+func HashStringWithPepper(s string, pepper *Pepper) (string, error) {
+	return hashPassword(DefaultArgon2idHasher, pepper, s)
 }
 
+// IsHashSameAsUnhashedString accepts any format in passwordHashers, detected by the hash prefix.
+// Peppered hashes never match, see IsHashSameAsUnhashedStringWithPepper.
 func IsHashSameAsUnhashedString(hashed, unhashed string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(unhashed))
+	return IsHashSameAsUnhashedStringWithPepper(hashed, unhashed, nil)
+}
+
+// IsHashSameAsUnhashedStringWithPepper also accepts hashes keyed with any version of pepper.
+func IsHashSameAsUnhashedStringWithPepper(hashed, unhashed string, pepper *Pepper) bool {
+	same, err := verifyPassword(pepper, hashed, unhashed)
 	if err != nil {
 		return false
-	} else {
-		return true
 	}
+	return same
+}
+
+// HashToken is the SHA-256 digest stored in place of a bearer token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func GetRandomAlphanumericString(length int) (string, error) {
@@ -40,7 +54,7 @@ func GetRandomAlphanumericString(length int) (string, error) {
 	return string(result), nil
 }
 
-func GenerateJWT(issuer string, subject string, audience []string, expiration time.Time, notBefore time.Time, issuedAt time.Time, jwtID string, jwtSigningKey string) (string, error) {
+func GenerateJWT(issuer string, subject string, audience []string, expiration time.Time, notBefore time.Time, issuedAt time.Time, jwtID string, signer Signer) (string, error) {
 	claims := jwt.RegisteredClaims{
 		Issuer:    issuer,
 		Subject:   subject,
@@ -51,8 +65,11 @@ func GenerateJWT(issuer string, subject string, audience []string, expiration ti
 		ID:        jwtID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(jwtSigningKey))
+	return GenerateJWTWithClaims(claims, signer)
+}
+
+func GenerateJWTWithClaims(claims jwt.Claims, signer Signer) (string, error) {
+	signedToken, err := signer.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -60,15 +77,29 @@ func GenerateJWT(issuer string, subject string, audience []string, expiration ti
 	return signedToken, nil
 }
 
-func VerifyJWT(tokenString string, jwtSigningKey string) (*jwt.RegisteredClaims, error) {
-	claims := &jwt.RegisteredClaims{}
+func VerifyJWT(tokenString string, keys KeyResolver) (*AccessTokenClaims, error) {
+	return parseJWT(tokenString, keys)
+}
+
+func parseJWT(tokenString string, keys KeyResolver, opts ...jwt.ParserOption) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, ok := token.Header["kid"].(string)
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("missing kid header")
+		}
+
+		key, err := keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(jwtSigningKey), nil
-	})
+		return key.PublicKey, nil
+	}, opts...)
 
 	if err != nil {
 		return nil, err
@@ -82,8 +113,12 @@ func VerifyJWT(tokenString string, jwtSigningKey string) (*jwt.RegisteredClaims,
 }
 
 func ValidateJWT(claims *jwt.RegisteredClaims) error {
-	if claims.NotBefore.After(time.Now()) && claims.ExpiresAt.Before(time.Now()) {
+	now := time.Now()
+	if claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Time) {
 		return fmt.Errorf("token has expired")
 	}
+	if claims.NotBefore != nil && now.Before(claims.NotBefore.Time) {
+		return fmt.Errorf("token is not valid yet")
+	}
 	return nil
 }
@@ -0,0 +1,130 @@
+package authentication
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type TokenValidationPolicy struct {
+	// Issuer the iss claim must equal. Empty accepts any issuer.
+	Issuer string
+	// Audiences of which the aud claim must contain at least one. Empty accepts any audience.
+	Audiences []string
+	// Leeway tolerated on exp, nbf and iat for clock skew between services.
+	Leeway time.Duration
+	// MaxAge rejects access tokens issued longer ago than this, regardless of exp. Zero disables the check.
+	// It does not apply to refresh tokens, which last as long as their TokenLifetimePolicy allows.
+	MaxAge time.Duration
+	// RequiredClaims must be present in the token, e.g. "sub", "jti", "sid" or a custom claim name.
+	RequiredClaims []string
+}
+
+var defaultRequiredClaims = []string{"sub", "exp", "jti"}
+
+type TokenValidator struct {
+	keys   KeyResolver
+	policy TokenValidationPolicy
+	now    func() time.Time
+}
+
+func NewTokenValidator(keys KeyResolver, policy TokenValidationPolicy) *TokenValidator {
+	return &TokenValidator{keys: keys, policy: policy, now: time.Now}
+}
+
+func (v *TokenValidator) Validate(tokenString string) (*AccessTokenClaims, error) {
+	claims, err := v.validate(tokenString, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.checkMaxAge(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ValidateRefreshToken checks everything Validate does except MaxAge.
+func (v *TokenValidator) ValidateRefreshToken(tokenString string) (*AccessTokenClaims, error) {
+	return v.validate(tokenString, false)
+}
+
+// ValidateIgnoringExpiry checks signature, issuer, audience and required claims but not token age.
+// It is meant for revoking tokens that may already have expired.
+func (v *TokenValidator) ValidateIgnoringExpiry(tokenString string) (*AccessTokenClaims, error) {
+	return v.validate(tokenString, true)
+}
+
+func (v *TokenValidator) validate(tokenString string, ignoreExpiry bool) (*AccessTokenClaims, error) {
+	opts := []jwt.ParserOption{jwt.WithTimeFunc(v.now)}
+	if ignoreExpiry {
+		opts = append(opts, jwt.WithoutClaimsValidation())
+	} else {
+		opts = append(opts, jwt.WithLeeway(v.policy.Leeway), jwt.WithIssuedAt(), jwt.WithExpirationRequired())
+	}
+
+	claims, err := parseJWT(tokenString, v.keys, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.policy.Issuer != "" && claims.Issuer != v.policy.Issuer {
+		return nil, fmt.Errorf("token has invalid issuer")
+	}
+
+	if len(v.policy.Audiences) > 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.policy.Audiences, aud)
+	}) {
+		return nil, fmt.Errorf("token has invalid audience")
+	}
+
+	for _, name := range v.policy.RequiredClaims {
+		if !hasClaim(claims, name) {
+			return nil, fmt.Errorf("token is missing required claim: %s", name)
+		}
+	}
+
+	return claims, nil
+}
+
+func (v *TokenValidator) checkMaxAge(claims *AccessTokenClaims) error {
+	if v.policy.MaxAge <= 0 {
+		return nil
+	}
+	if claims.IssuedAt == nil {
+		return fmt.Errorf("token is missing required claim: iat")
+	}
+	if v.now().Sub(claims.IssuedAt.Time) > v.policy.MaxAge+v.policy.Leeway {
+		return fmt.Errorf("token is too old")
+	}
+	return nil
+}
+
+func hasClaim(claims *AccessTokenClaims, name string) bool {
+	switch name {
+	case "iss":
+		return claims.Issuer != ""
+	case "sub":
+		return claims.Subject != ""
+	case "aud":
+		return len(claims.Audience) > 0
+	case "exp":
+		return claims.ExpiresAt != nil
+	case "nbf":
+		return claims.NotBefore != nil
+	case "iat":
+		return claims.IssuedAt != nil
+	case "jti":
+		return claims.ID != ""
+	case "email_verified":
+		return claims.EmailVerified != nil
+	case "public_identifier":
+		return claims.PublicIdentifier != ""
+	case "sid":
+		return claims.SessionID != ""
+	default:
+		_, ok := claims.Custom[name]
+		return ok
+	}
+}
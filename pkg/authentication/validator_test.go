@@ -0,0 +1,113 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenValidator(t *testing.T) {
+	signer := newTestSigner(t)
+	now := time.Now().UTC()
+
+	sign := func(claims AccessTokenClaims) string {
+		token, err := GenerateJWTWithClaims(&claims, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := func() AccessTokenClaims {
+		return AccessTokenClaims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://test.com",
+			Subject:   "subject",
+			Audience:  jwt.ClaimStrings{"api"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti",
+		}}
+	}
+
+	validator := NewTokenValidator(signer, TokenValidationPolicy{
+		Issuer:         "https://test.com",
+		Audiences:      []string{"api", "admin"},
+		Leeway:         5 * time.Second,
+		MaxAge:         time.Hour,
+		RequiredClaims: []string{"sub", "jti", "sid"},
+	})
+
+	claims := valid()
+	claims.SessionID = "session"
+	if _, err := validator.Validate(sign(claims)); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	cases := map[string]func(c *AccessTokenClaims){
+		"issuer":      func(c *AccessTokenClaims) { c.Issuer = "https://other.com" },
+		"audience":    func(c *AccessTokenClaims) { c.Audience = jwt.ClaimStrings{"other"} },
+		"expired":     func(c *AccessTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) },
+		"not before":  func(c *AccessTokenClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) },
+		"too old":     func(c *AccessTokenClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(-2 * time.Hour)) },
+		"missing sid": func(c *AccessTokenClaims) { c.SessionID = "" },
+		"missing exp": func(c *AccessTokenClaims) { c.ExpiresAt = nil },
+		"missing jti": func(c *AccessTokenClaims) { c.ID = "" },
+	}
+	for name, mutate := range cases {
+		claims := valid()
+		claims.SessionID = "session"
+		mutate(&claims)
+		if _, err := validator.Validate(sign(claims)); err == nil {
+			t.Errorf("%s: invalid token accepted", name)
+		}
+	}
+
+	claims = valid()
+	claims.SessionID = "session"
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(-2 * time.Second))
+	if _, err := validator.Validate(sign(claims)); err != nil {
+		t.Fatalf("token within leeway rejected: %v", err)
+	}
+
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Hour))
+	if _, err := validator.ValidateIgnoringExpiry(sign(claims)); err != nil {
+		t.Fatalf("expired token rejected when ignoring expiry: %v", err)
+	}
+
+	// MaxAge limits access tokens only; refresh tokens last their own lifetime.
+	old := valid()
+	old.SessionID = "session"
+	old.IssuedAt = jwt.NewNumericDate(now.Add(-2 * time.Hour))
+	if _, err := validator.ValidateRefreshToken(sign(old)); err != nil {
+		t.Fatalf("refresh token rejected for its age: %v", err)
+	}
+
+	dal := &DALPostgres{validator: NewTokenValidator(signer, TokenValidationPolicy{MaxAge: time.Hour, RequiredClaims: defaultRequiredClaims})}
+	if _, _, err := dal.verifyToken(sign(old)); err == nil {
+		t.Fatal("access token older than MaxAge accepted")
+	}
+	old.SessionID = ""
+	if _, _, err := dal.verifyToken(sign(old)); err != nil {
+		t.Fatalf("refresh token older than MaxAge rejected: %v", err)
+	}
+}
+
+func TestValidateJWT(t *testing.T) {
+	now := time.Now()
+
+	expired := &jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute))}
+	if err := ValidateJWT(expired); err == nil {
+		t.Fatal("expired token accepted")
+	}
+
+	notYetValid := &jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)), NotBefore: jwt.NewNumericDate(now.Add(time.Minute))}
+	if err := ValidateJWT(notYetValid); err == nil {
+		t.Fatal("not yet valid token accepted")
+	}
+
+	valid := &jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)), NotBefore: jwt.NewNumericDate(now)}
+	if err := ValidateJWT(valid); err != nil {
+		t.Fatal(err)
+	}
+}